@@ -8,10 +8,10 @@ import (
 	"io/ioutil"
 	"time"
 
+	"github.com/v2fly/v2ray-core/v5"
+	"github.com/v2fly/v2ray-core/v5/app/proxyman/command"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
 	"google.golang.org/grpc"
-	"v2ray.com/core"
-	"v2ray.com/core/app/proxyman/command"
-	"v2ray.com/core/infra/conf"
 )
 
 // APIServer represent a V2Ray API server
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/qjebbs/v2tool/exporter"
+	vmessping "github.com/qjebbs/v2tool/vmessping"
+)
+
+func exporterCmd(args []string) {
+	cmd := flag.NewFlagSet("v2tool exporter", flag.ExitOnError)
+	listen := cmd.String("l", ":9110", "listen address of the metrics server")
+	verbose := cmd.Bool("v", false, "verbose (debug log)")
+	usemux := cmd.Bool("m", false, "use mux outbound")
+	desturl := cmd.String("dest", "http://www.google.com/gen_204", "the test destination url, need 204 for success return")
+	timeout := cmd.Uint("o", 10, "timeout seconds for each request")
+	inteval := cmd.Uint("i", 60, "inteval seconds between probes of a node")
+	infoInteval := cmd.Uint("info", 600, "inteval seconds between node ip lookups, 0 to disable")
+	workers := cmd.Uint("w", 8, "max probes in flight")
+	cmd.Parse(args)
+
+	if cmd.NArg() == 0 {
+		fmt.Println("To export metrics of nodes in links, json files, folders, subscriptions or link files:")
+		fmt.Println(os.Args[0], "exporter path/to/folder https://sub.url path/to/links.txt")
+		fmt.Println()
+		cmd.Usage()
+		os.Exit(1)
+	}
+	nodes, err := vmessping.LoadNodes(cmd.Args())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	e, err := exporter.New(nodes, &exporter.Options{
+		Dest:         *desturl,
+		Timeout:      time.Second * time.Duration(*timeout),
+		Interval:     time.Second * time.Duration(*inteval),
+		InfoInterval: time.Second * time.Duration(*infoInteval),
+		Workers:      *workers,
+		Verbose:      *verbose,
+		UseMux:       *usemux,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx := signalContext()
+	go func() {
+		http.Handle("/metrics", e)
+		log.Printf("serving metrics of %d node(s) on %s/metrics", e.NodeCount(), *listen)
+		log.Fatalln(http.ListenAndServe(*listen, nil))
+	}()
+	if err := e.Run(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
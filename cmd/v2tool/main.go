@@ -23,6 +23,7 @@ The commands are:
 	ping            ping a vmess link / json outbound file (vmessping)
 	outbound        add / remove outbounds through v2ray api server
 	subscriptions   fetches subscription specified by config
+	exporter        probe nodes on schedule and serve Prometheus metrics
 
 Use "v2tool help <command>" for more information about a command.
 `
@@ -55,12 +56,14 @@ func main() {
 		mergeConfig(args)
 	case "subscriptions":
 		subscriptionsCmd(args)
+	case "exporter":
+		exporterCmd(args)
 	default:
 		usageAndExit(1)
 	}
 }
 
 func usageAndExit(code int) {
-	fmt.Println(usage)
+	fmt.Print(usage + "\n")
 	os.Exit(code)
 }
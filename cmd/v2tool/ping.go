@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	vmessping "github.com/qjebbs/v2tool/vmessping"
 )
@@ -20,8 +22,39 @@ func ping(args []string) {
 	timeout := pingCmd.Uint("o", 10, "timeout seconds for each request")
 	inteval := pingCmd.Uint("i", 1, "inteval seconds between pings")
 	quit := pingCmd.Uint("q", 0, "fast quit on error counts")
+	format := pingCmd.String("format", "text", "output format: text, json or csv")
+	batch := pingCmd.Bool("batch", false, "ping all nodes of the given links, json files, folders, subscription URLs or link files")
+	workers := pingCmd.Uint("w", 8, "max nodes being probed concurrently in batch mode")
 	pingCmd.Parse(args)
 
+	if *batch {
+		countSet := false
+		pingCmd.Visit(func(f *flag.Flag) {
+			if f.Name == "c" {
+				countSet = true
+			}
+		})
+		if !countSet {
+			*count = 5
+		}
+	}
+	opts := &vmessping.Options{
+		Count:    *count,
+		Dest:     *desturl,
+		Timeout:  time.Second * time.Duration(*timeout),
+		Interval: time.Second * time.Duration(*inteval),
+		Quit:     *quit,
+		ShowNode: *showNode,
+		Verbose:  *verbose,
+		UseMux:   *usemux,
+	}
+	ctx := signalContext()
+
+	if *batch {
+		pingBatch(ctx, pingCmd, *format, *workers, opts)
+		return
+	}
+
 	var vmess string
 	if pingCmd.NArg() == 0 {
 		if vmess = os.Getenv("VMESS"); vmess == "" {
@@ -38,16 +71,75 @@ func ping(args []string) {
 		vmess = pingCmd.Args()[0]
 	}
 
-	osSignals := make(chan os.Signal, 1)
-	signal.Notify(osSignals, os.Interrupt, os.Kill, syscall.SIGTERM)
+	rep, err := vmessping.NewReporter(os.Stdout, *format, *desturl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	vmessping.PrintVersion(MAINVER)
-	ps, err := vmessping.Ping(vmess, *count, *desturl, *timeout, *inteval, *quit, osSignals, *showNode, *verbose, *usemux)
+	p := vmessping.NewPinger(vmess, opts)
+	vmessping.Attach(p, rep)
+	ps, err := p.Run(ctx)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	ps.PrintStats()
 	if ps.IsErr() {
 		os.Exit(1)
 	}
 }
+
+func pingBatch(ctx context.Context, pingCmd *flag.FlagSet, format string, workers uint, opts *vmessping.Options) {
+	if pingCmd.NArg() == 0 {
+		fmt.Println("To ping all nodes in folders, subscriptions or link files:")
+		fmt.Println(os.Args[0], "ping -batch path/to/folder https://sub.url path/to/links.txt")
+		fmt.Println()
+		pingCmd.Usage()
+		os.Exit(1)
+	}
+	nodes, err := vmessping.LoadNodes(pingCmd.Args())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// the ranked table is the text output, per-request records
+	// are only emitted in machine-readable formats
+	var setup func(p *vmessping.Pinger)
+	if format != "text" {
+		rep, err := vmessping.NewReporter(os.Stdout, format, opts.Dest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		setup = func(p *vmessping.Pinger) {
+			vmessping.Attach(p, rep)
+		}
+	}
+
+	vmessping.PrintVersion(MAINVER)
+	if setup == nil {
+		fmt.Printf("Pinging %d node(s), %d request(s) each...\n", len(nodes), opts.Count)
+	}
+	results, err := vmessping.PingMany(ctx, nodes, workers, opts, setup)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if setup == nil {
+		vmessping.WriteBatchStats(os.Stdout, results)
+	}
+}
+
+// signalContext returns a context which is canceled on interrupt
+func signalContext() context.Context {
+	osSignals := make(chan os.Signal, 1)
+	signal.Notify(osSignals, os.Interrupt, os.Kill, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-osSignals
+		cancel()
+	}()
+	return ctx
+}
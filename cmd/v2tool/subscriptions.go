@@ -3,10 +3,14 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/qjebbs/v2tool/api"
 	"github.com/qjebbs/v2tool/files"
-	"github.com/qjebbs/v2tool/vmess"
+	"github.com/qjebbs/v2tool/subscription"
 )
 
 func subscriptionsCmd(args []string) {
@@ -14,6 +18,11 @@ func subscriptionsCmd(args []string) {
 	conf := subsCmd.String("c", "", "subscriptions config file")
 	outdir := subsCmd.String("o", ".", "output dir")
 	socketMark := subsCmd.Int("m", 0, "SO_MARK for outbounds")
+	dryRun := subsCmd.Bool("dry-run", false, "show the diff of changes, without writing any file")
+	prune := subsCmd.Bool("prune", false, "remove stale json files in output dir")
+	watch := subsCmd.Bool("watch", false, "keep running, and refresh each subscription on its interval")
+	interval := subsCmd.Duration("interval", time.Hour, "refresh interval for subscriptions without one, in watch mode")
+	apiAddr := subsCmd.String("api", "", "apply changes to a running v2ray through the api server, e.g.: 127.0.0.1:10085, outbounds of stale files are removed only with -prune")
 	err := subsCmd.Parse(args)
 	if err != nil {
 		fmt.Println(err)
@@ -33,7 +42,32 @@ func subscriptionsCmd(args []string) {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	err = vmess.FetchSubscriptions(c, d, int32(*socketMark))
+	opts := &subscription.Options{
+		SocketMark: int32(*socketMark),
+		DryRun:     *dryRun,
+		Prune:      *prune,
+		Interval:   *interval,
+	}
+	if *apiAddr != "" {
+		host, port, err := net.SplitHostPort(*apiAddr)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			fmt.Println("invalid api port:", port)
+			os.Exit(1)
+		}
+		server := &api.APIServer{Host: host, Port: uint16(p)}
+		defer server.Close()
+		opts.API = server
+	}
+	if *watch {
+		err = subscription.Watch(signalContext(), c, d, opts)
+	} else {
+		err = subscription.Fetch(c, d, opts)
+	}
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
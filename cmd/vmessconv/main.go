@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/qjebbs/v2tool/vmess"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
 )
 
 var (
@@ -17,11 +21,15 @@ func main() {
 	showN := flag.Bool("n", false, "show v2rayN/NG format")
 	showRK := flag.Bool("r", false, "show shadowrocket format")
 	showQ := flag.Bool("q", false, "show Quantumult format")
+	showX := flag.Bool("x", false, "show Quantumult X format")
+	showS := flag.Bool("s", false, "show Surge format")
+	showJ := flag.Bool("j", false, "show outbound json")
+	showC := flag.Bool("clash", false, "show clash proxies of all given links")
 	flag.Parse()
 	var link string
 	if flag.NArg() == 0 {
 		if link = os.Getenv("VMESS"); link == "" {
-			fmt.Println(os.Args[0], "vmess://....")
+			fmt.Println(os.Args[0], "vmess://.... | vless://.... | ss://.... | trojan://.... | outbound.json")
 			flag.Usage()
 			os.Exit(1)
 		}
@@ -29,26 +37,144 @@ func main() {
 		link = flag.Args()[0]
 	}
 
-	lk, err := vmess.ParseVmess(link)
+	if *showC {
+		// yaml only, so that it can be redirected into clash config
+		links := make([]vmess.ProxyLink, 0, flag.NArg())
+		args := flag.Args()
+		if len(args) == 0 {
+			args = []string{link}
+		}
+		for _, arg := range args {
+			lk, err := parseArg(arg)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			links = append(links, lk)
+		}
+		b, err := vmess.ClashProxies(links)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Print(string(b))
+		return
+	}
+
+	plk, err := parseArg(link)
 	if err != nil {
 		log.Fatalln(err)
 	}
+
+	if *showJ {
+		// json only, so that it can be piped into a json consumer
+		out, err := plk.ToOutbound(false)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if l, ok := plk.(*vmess.Link); ok {
+			if lost := l.LossyFields("json"); len(lost) > 0 {
+				fmt.Fprintf(os.Stderr, "(json format cannot carry: %s)\n", strings.Join(lost, ", "))
+			}
+		}
+		b, err := json.MarshalIndent(map[string]interface{}{
+			"outbounds": []interface{}{out},
+		}, "", "  ")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+
 	fmt.Println("VmessConvert:", MAINVER)
+	switch l := plk.(type) {
+	case *vmess.SSLink:
+		fmt.Println("SIP002:", l.LinkStr("sip002"))
+		fmt.Println()
+		fmt.Println("Legacy:", l.LinkStr("legacy"))
+		return
+	case *vmess.VlessLink:
+		fmt.Println("VLESS:", l.LinkStr())
+		return
+	case *vmess.TrojanLink:
+		fmt.Println("Trojan:", l.LinkStr())
+		return
+	}
+	lk, ok := plk.(*vmess.Link)
+	if !ok {
+		fmt.Printf("%s: %s\n", strings.ToUpper(plk.Protocol()), plk.ShareLink())
+		return
+	}
 
+	show := func(name, format string) {
+		fmt.Println(name+":", lk.LinkStr(format))
+		if lost := lk.LossyFields(format); len(lost) > 0 {
+			fmt.Printf("(%s format cannot carry: %s)\n", name, strings.Join(lost, ", "))
+		}
+	}
 	if *showN {
-		fmt.Println("V2rayN:", lk.LinkStr("ng"))
+		show("V2rayN", "ng")
 	}
 	if *showRK {
-		fmt.Println("ShadowRocket:", lk.LinkStr("rk"))
+		show("ShadowRocket", "rk")
 	}
 	if *showQ {
-		fmt.Println("Quantumult:", lk.LinkStr("quan"))
+		show("Quantumult", "quan")
+	}
+	if *showX {
+		show("QuantumultX", "quanx")
 	}
-	if !*showN && !*showRK && !*showQ {
-		fmt.Println("V2rayN:", lk.LinkStr("ng"))
+	if *showS {
+		show("Surge", "surge")
+	}
+	if !*showN && !*showRK && !*showQ && !*showX && !*showS {
+		show("V2rayN", "ng")
+		fmt.Println()
+		show("ShadowRocket", "rk")
+		fmt.Println()
+		show("Quantumult", "quan")
 		fmt.Println()
-		fmt.Println("ShadowRocket:", lk.LinkStr("rk"))
+		show("QuantumultX", "quanx")
 		fmt.Println()
-		fmt.Println("Quantumult:", lk.LinkStr("quan"))
+		show("Surge", "surge")
+	}
+}
+
+// parseArg parses a share link, or a vmess outbound json file,
+// vmess links are validated, and warned to stderr if invalid
+func parseArg(arg string) (vmess.ProxyLink, error) {
+	lk, err := parseLink(arg)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := lk.(*vmess.Link); ok {
+		// it's converted anyway, the core may take it, e.g.: unknown scy as "auto"
+		if errs := l.Validate(); errs != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", errs)
+		}
+	}
+	return lk, nil
+}
+
+func parseLink(arg string) (vmess.ProxyLink, error) {
+	if vmess.IsSupportedLink(strings.TrimSpace(arg)) {
+		return vmess.ParseLink(arg)
+	}
+	if _, err := os.Stat(arg); err != nil {
+		return nil, fmt.Errorf("neither a supported link nor a file: %s", arg)
+	}
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	c := &conf.Config{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	out := &conf.OutboundDetourConfig{}
+	if len(c.OutboundConfigs) > 0 {
+		out = &c.OutboundConfigs[0]
+	} else if err := json.Unmarshal(data, out); err != nil || out.Protocol == "" {
+		return nil, fmt.Errorf("no outbound found in %s", arg)
 	}
+	return vmess.Outbound2Link(out)
 }
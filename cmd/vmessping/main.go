@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	vmessping "github.com/qjebbs/v2tool/vmessping"
 )
@@ -23,6 +25,7 @@ func main() {
 	timeout := flag.Uint("o", 10, "timeout seconds for each request")
 	inteval := flag.Uint("i", 1, "inteval seconds between pings")
 	quit := flag.Uint("q", 0, "fast quit on error counts")
+	format := flag.String("format", "text", "output format: text, json or csv")
 	flag.Parse()
 
 	var vmess string
@@ -43,13 +46,35 @@ func main() {
 
 	osSignals := make(chan os.Signal, 1)
 	signal.Notify(osSignals, os.Interrupt, os.Kill, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-osSignals
+		cancel()
+	}()
+
+	rep, err := vmessping.NewReporter(os.Stdout, *format, *desturl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	vmessping.PrintVersion(MAINVER)
-	ps, err := vmessping.Ping(vmess, *count, *desturl, *timeout, *inteval, *quit, osSignals, *showNode, *verbose, *usemux)
+	p := vmessping.NewPinger(vmess, &vmessping.Options{
+		Count:    *count,
+		Dest:     *desturl,
+		Timeout:  time.Second * time.Duration(*timeout),
+		Interval: time.Second * time.Duration(*inteval),
+		Quit:     *quit,
+		ShowNode: *showNode,
+		Verbose:  *verbose,
+		UseMux:   *usemux,
+	})
+	vmessping.Attach(p, rep)
+	ps, err := p.Run(ctx)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	ps.PrintStats()
 	if ps.IsErr() {
 		os.Exit(1)
 	}
@@ -136,7 +136,7 @@ func (l *ServerList) FindServer(serverID []int) Servers {
 func (l ServerList) Show() {
 	for _, s := range l.Servers {
 		fmt.Printf("[%4s] %8.2fkm ", s.ID, s.Distance)
-		fmt.Printf(s.Name + " (" + s.Country + ") by " + s.Sponsor + "\n")
+		fmt.Printf("%s (%s) by %s\n", s.Name, s.Country, s.Sponsor)
 	}
 }
 
@@ -144,7 +144,7 @@ func (l ServerList) Show() {
 func (s Server) Show() {
 	fmt.Printf(" \n")
 	fmt.Printf("Target Server: [%4s] %8.2fkm ", s.ID, s.Distance)
-	fmt.Printf(s.Name + " (" + s.Country + ") by " + s.Sponsor + "\n")
+	fmt.Printf("%s (%s) by %s\n", s.Name, s.Country, s.Sponsor)
 }
 
 // StartTest : start testing to the servers.
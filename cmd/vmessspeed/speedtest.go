@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
 
 	mv2ray "github.com/qjebbs/v2tool/miniv2ray"
+	"github.com/qjebbs/v2tool/vmess"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -38,6 +40,9 @@ func main() {
 
 	setTimeout()
 
+	if lk, err := vmess.ParseLink(*vmessLink); err == nil {
+		fmt.Println("\n" + lk.DetailStr())
+	}
 	server, err := mv2ray.StartV2Ray(*vmessLink, *debug, true)
 	if err != nil {
 		log.Fatalln(err)
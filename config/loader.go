@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"io"
 
-	"v2ray.com/core/common/errors"
-	json_reader "v2ray.com/core/infra/conf/json"
+	"github.com/v2fly/v2ray-core/v5/common/errors"
+	json_reader "github.com/v2fly/v2ray-core/v5/infra/conf/json"
 )
 
 type offset struct {
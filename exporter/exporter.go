@@ -0,0 +1,293 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mv2ray "github.com/qjebbs/v2tool/miniv2ray"
+	"github.com/qjebbs/v2tool/vmessping"
+	"github.com/v2fly/v2ray-core/v5"
+)
+
+// DefaultBuckets are the default latency histogram buckets, in seconds
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Options are the options of an Exporter
+type Options struct {
+	// Dest is the test destination url, defaults to http://www.google.com/gen_204
+	Dest string
+	// Timeout is the timeout of each probe, defaults to 10 seconds
+	Timeout time.Duration
+	// Interval is the interval between probes of a node, defaults to 60 seconds
+	Interval time.Duration
+	// InfoInterval is the interval between node ip lookups, 0 to disable
+	InfoInterval time.Duration
+	// Workers is the max count of probes in flight, defaults to 1
+	Workers uint
+	// Buckets are the upper bounds of latency histogram, in seconds,
+	// they must be positive and distinct, defaults to DefaultBuckets
+	Buckets []float64
+	// Verbose enables debug log of the core
+	Verbose bool
+	// UseMux enables mux of outbounds
+	UseMux bool
+}
+
+// Exporter probes nodes on schedule, and serves the metrics in Prometheus text format
+type Exporter struct {
+	opts   *Options
+	nodes  []*nodeMetrics
+	server *core.Instance
+	sem    chan struct{}
+}
+
+type nodeMetrics struct {
+	sync.Mutex
+	name     string
+	tag      string
+	buckets  []uint64
+	sum      float64
+	count    uint64
+	success  uint64
+	failure  uint64
+	up       bool
+	ip       string
+	loc      string
+	lastSeen time.Time
+}
+
+// withDefaults returns a copy of o, with the defaults of zero fields and sorted buckets
+func (o *Options) withDefaults() (*Options, error) {
+	opts := &Options{}
+	if o != nil {
+		*opts = *o
+	}
+	if opts.Dest == "" {
+		opts.Dest = "http://www.google.com/gen_204"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 60 * time.Second
+	}
+	if opts.Workers == 0 {
+		opts.Workers = 1
+	}
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	buckets := make([]float64, len(opts.Buckets))
+	copy(buckets, opts.Buckets)
+	sort.Float64s(buckets)
+	for i, b := range buckets {
+		// +Inf is always there, as the count
+		if !(b > 0) || math.IsInf(b, 1) {
+			return nil, fmt.Errorf("invalid bucket: %g", b)
+		}
+		if i > 0 && b == buckets[i-1] {
+			return nil, fmt.Errorf("duplicated bucket: %g", b)
+		}
+	}
+	opts.Buckets = buckets
+	return opts, nil
+}
+
+// New creates an exporter for nodes, nodes failed to build are skipped with a log,
+// a nil opts is taken as the defaults
+func New(nodes []*vmessping.Node, opts *Options) (*Exporter, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		opts: opts,
+		sem:  make(chan struct{}, opts.Workers),
+	}
+	obs := make([]*core.OutboundHandlerConfig, 0, len(nodes))
+	// series of the same label values are not allowed
+	names := make(map[string]int)
+	for i, node := range nodes {
+		ob, err := mv2ray.Outbound(node.Vmess, opts.UseMux)
+		if err != nil {
+			log.Printf("skip node %s: %v", node.Name, err)
+			continue
+		}
+		ob.Tag = fmt.Sprintf("node-%d", i)
+		obs = append(obs, ob)
+		name := node.Name
+		if names[name]++; names[name] > 1 {
+			name = fmt.Sprintf("%s #%d", name, names[name])
+		}
+		e.nodes = append(e.nodes, &nodeMetrics{
+			name:    name,
+			tag:     ob.Tag,
+			buckets: make([]uint64, len(opts.Buckets)),
+		})
+	}
+	if len(obs) == 0 {
+		return nil, fmt.Errorf("no valid node to probe")
+	}
+	server, err := mv2ray.StartOutbounds(obs, opts.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	e.server = server
+	return e, nil
+}
+
+// NodeCount returns the count of nodes being probed, skipped ones excluded
+func (e *Exporter) NodeCount() int {
+	return len(e.nodes)
+}
+
+// Run starts the core and probes all nodes until ctx is done
+func (e *Exporter) Run(ctx context.Context) error {
+	if err := e.server.Start(); err != nil {
+		return err
+	}
+	defer e.server.Close()
+
+	var wg sync.WaitGroup
+	for _, n := range e.nodes {
+		wg.Add(1)
+		go func(n *nodeMetrics) {
+			defer wg.Done()
+			e.probeLoop(ctx, n)
+		}(n)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (e *Exporter) probeLoop(ctx context.Context, n *nodeMetrics) {
+	var lastInfo time.Time
+	for {
+		select {
+		case e.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		delay, err := mv2ray.MeasureDelayTag(e.server, n.tag, e.opts.Timeout, e.opts.Dest)
+		e.observe(n, delay, err)
+		if err == nil && e.opts.InfoInterval > 0 && time.Since(lastInfo) >= e.opts.InfoInterval {
+			if info, err := mv2ray.GetNodeInfoTag(e.server, n.tag, e.opts.Timeout); err == nil {
+				lastInfo = time.Now()
+				n.Lock()
+				n.ip, n.loc = info["ip"], info["loc"]
+				n.Unlock()
+			}
+		}
+		<-e.sem
+
+		select {
+		case <-time.After(e.opts.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Exporter) observe(n *nodeMetrics, delay int64, err error) {
+	n.Lock()
+	defer n.Unlock()
+	if err != nil {
+		n.failure++
+		n.up = false
+		return
+	}
+	n.success++
+	n.up = true
+	n.lastSeen = time.Now()
+	sec := float64(delay) / 1000
+	n.sum += sec
+	n.count++
+	for i, b := range e.opts.Buckets {
+		if sec <= b {
+			n.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in Prometheus text format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteMetrics(w)
+}
+
+// WriteMetrics writes the metrics in Prometheus text format to w
+func (e *Exporter) WriteMetrics(w io.Writer) {
+	nodes := make([]*nodeMetrics, len(e.nodes))
+	copy(nodes, e.nodes)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+
+	fmt.Fprintln(w, "# HELP v2tool_probe_duration_seconds Latency of successful probes.")
+	fmt.Fprintln(w, "# TYPE v2tool_probe_duration_seconds histogram")
+	for _, n := range nodes {
+		n.Lock()
+		name := escapeLabel(n.name)
+		for i, b := range e.opts.Buckets {
+			fmt.Fprintf(w, "v2tool_probe_duration_seconds_bucket{node=\"%s\",le=\"%g\"} %d\n", name, b, n.buckets[i])
+		}
+		fmt.Fprintf(w, "v2tool_probe_duration_seconds_bucket{node=\"%s\",le=\"+Inf\"} %d\n", name, n.count)
+		fmt.Fprintf(w, "v2tool_probe_duration_seconds_sum{node=\"%s\"} %g\n", name, n.sum)
+		fmt.Fprintf(w, "v2tool_probe_duration_seconds_count{node=\"%s\"} %d\n", name, n.count)
+		n.Unlock()
+	}
+
+	writeSeries := func(metric, help string, value func(n *nodeMetrics) string) {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+		typ := "gauge"
+		if strings.HasSuffix(metric, "_total") {
+			typ = "counter"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric, typ)
+		for _, n := range nodes {
+			n.Lock()
+			fmt.Fprintf(w, "%s{node=\"%s\"} %s\n", metric, escapeLabel(n.name), value(n))
+			n.Unlock()
+		}
+	}
+	writeSeries("v2tool_probe_success_total", "Count of successful probes.", func(n *nodeMetrics) string {
+		return fmt.Sprint(n.success)
+	})
+	writeSeries("v2tool_probe_failure_total", "Count of failed probes.", func(n *nodeMetrics) string {
+		return fmt.Sprint(n.failure)
+	})
+	writeSeries("v2tool_node_up", "Whether the last probe succeeded.", func(n *nodeMetrics) string {
+		if n.up {
+			return "1"
+		}
+		return "0"
+	})
+	writeSeries("v2tool_node_last_seen_timestamp_seconds", "Unix time of the last successful probe.", func(n *nodeMetrics) string {
+		if n.lastSeen.IsZero() {
+			return "0"
+		}
+		return fmt.Sprint(n.lastSeen.Unix())
+	})
+
+	fmt.Fprintln(w, "# HELP v2tool_node_info Outbound ip and location of the node, last seen from cdn-cgi/trace.")
+	fmt.Fprintln(w, "# TYPE v2tool_node_info gauge")
+	for _, n := range nodes {
+		n.Lock()
+		if n.ip != "" {
+			fmt.Fprintf(w, "v2tool_node_info{node=\"%s\",ip=\"%s\",loc=\"%s\"} 1\n", escapeLabel(n.name), escapeLabel(n.ip), escapeLabel(n.loc))
+		}
+		n.Unlock()
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
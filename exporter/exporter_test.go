@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qjebbs/v2tool/vmess"
+	"github.com/qjebbs/v2tool/vmessping"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	e := &Exporter{
+		opts: &Options{Buckets: []float64{0.1, 0.5}},
+		nodes: []*nodeMetrics{
+			{name: "b", buckets: make([]uint64, 2)},
+			{name: `a "1"`, buckets: make([]uint64, 2)},
+		},
+	}
+	a, b := e.nodes[1], e.nodes[0]
+	e.observe(a, 50, nil)
+	e.observe(a, 300, nil)
+	e.observe(a, 1000, nil)
+	e.observe(b, 0, errors.New("timeout"))
+	a.lastSeen = time.Unix(1600000000, 0)
+	a.ip, a.loc = "1.2.3.4", "US"
+
+	buf := new(bytes.Buffer)
+	e.WriteMetrics(buf)
+	want := `# HELP v2tool_probe_duration_seconds Latency of successful probes.
+# TYPE v2tool_probe_duration_seconds histogram
+v2tool_probe_duration_seconds_bucket{node="a \"1\"",le="0.1"} 1
+v2tool_probe_duration_seconds_bucket{node="a \"1\"",le="0.5"} 2
+v2tool_probe_duration_seconds_bucket{node="a \"1\"",le="+Inf"} 3
+v2tool_probe_duration_seconds_sum{node="a \"1\""} 1.35
+v2tool_probe_duration_seconds_count{node="a \"1\""} 3
+v2tool_probe_duration_seconds_bucket{node="b",le="0.1"} 0
+v2tool_probe_duration_seconds_bucket{node="b",le="0.5"} 0
+v2tool_probe_duration_seconds_bucket{node="b",le="+Inf"} 0
+v2tool_probe_duration_seconds_sum{node="b"} 0
+v2tool_probe_duration_seconds_count{node="b"} 0
+# HELP v2tool_probe_success_total Count of successful probes.
+# TYPE v2tool_probe_success_total counter
+v2tool_probe_success_total{node="a \"1\""} 3
+v2tool_probe_success_total{node="b"} 0
+# HELP v2tool_probe_failure_total Count of failed probes.
+# TYPE v2tool_probe_failure_total counter
+v2tool_probe_failure_total{node="a \"1\""} 0
+v2tool_probe_failure_total{node="b"} 1
+# HELP v2tool_node_up Whether the last probe succeeded.
+# TYPE v2tool_node_up gauge
+v2tool_node_up{node="a \"1\""} 1
+v2tool_node_up{node="b"} 0
+# HELP v2tool_node_last_seen_timestamp_seconds Unix time of the last successful probe.
+# TYPE v2tool_node_last_seen_timestamp_seconds gauge
+v2tool_node_last_seen_timestamp_seconds{node="a \"1\""} 1600000000
+v2tool_node_last_seen_timestamp_seconds{node="b"} 0
+# HELP v2tool_node_info Outbound ip and location of the node, last seen from cdn-cgi/trace.
+# TYPE v2tool_node_info gauge
+v2tool_node_info{node="a \"1\"",ip="1.2.3.4",loc="US"} 1
+`
+	if d := cmp.Diff(strings.Split(want, "\n"), strings.Split(buf.String(), "\n")); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"plain", "node 1", "node 1"},
+		{"quote", `a "b"`, `a \"b\"`},
+		{"backslash", `a\b`, `a\\b`},
+		{"newline", "a\nb", `a\nb`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeLabel(tt.s); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	link := (&vmess.Link{Ver: "2", Add: "127.0.0.1", Port: "1", ID: "27b8a625-4f4b-4428-9f0f-8a2317db7c79", Aid: "0", Net: "tcp", Type: "none"}).LinkStr("ng")
+	nodes := []*vmessping.Node{
+		{Name: "a", Vmess: link},
+		{Name: "invalid", Vmess: "vmess://invalid"},
+		{Name: "a", Vmess: link},
+		{Name: "b", Vmess: link},
+	}
+	e, err := New(nodes, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.server.Close()
+	if n := e.NodeCount(); n != 3 {
+		t.Errorf("got %d nodes, want 3", n)
+	}
+	names := make([]string, 0)
+	for _, n := range e.nodes {
+		names = append(names, n.name)
+		if len(n.buckets) != len(DefaultBuckets) {
+			t.Errorf("got %d buckets of %s, want %d", len(n.buckets), n.name, len(DefaultBuckets))
+		}
+	}
+	if d := cmp.Diff([]string{"a", "a #2", "b"}, names); d != "" {
+		t.Error(d)
+	}
+	if _, err := New(nodes[1:2], &Options{}); err == nil {
+		t.Error("want error of no valid node")
+	}
+}
+
+func TestOptionsWithDefaults(t *testing.T) {
+	buckets := []float64{1, 0.1, 0.5}
+	opts := &Options{Buckets: buckets}
+	got, err := opts.withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(&Options{Buckets: []float64{1, 0.1, 0.5}}, opts); d != "" {
+		t.Errorf("options changed: %s", d)
+	}
+	if d := cmp.Diff([]float64{0.1, 0.5, 1}, got.Buckets); d != "" {
+		t.Error(d)
+	}
+	if got.Interval == 0 || got.Timeout == 0 || got.Workers == 0 || got.Dest == "" {
+		t.Errorf("zero fields not defaulted: %+v", got)
+	}
+
+	got, err = (*Options)(nil).withDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(DefaultBuckets, got.Buckets); d != "" {
+		t.Error(d)
+	}
+
+	for _, b := range [][]float64{{0.1, 0}, {-1}, {0.5, 0.5}, {math.NaN()}, {math.Inf(1)}} {
+		if _, err := (&Options{Buckets: b}).withDefaults(); err == nil {
+			t.Errorf("want error for buckets %v", b)
+		}
+	}
+}
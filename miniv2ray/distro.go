@@ -4,55 +4,57 @@ import (
 
 	// The following are necessary as they register handlers in their init functions.
 	// Required features. Can't remove unless there is replacements.
-	_ "v2ray.com/core/app/dispatcher"
-	_ "v2ray.com/core/app/proxyman/inbound"
-	_ "v2ray.com/core/app/proxyman/outbound"
+	_ "github.com/v2fly/v2ray-core/v5/app/dispatcher"
+	_ "github.com/v2fly/v2ray-core/v5/app/proxyman/inbound"
+	_ "github.com/v2fly/v2ray-core/v5/app/proxyman/outbound"
 
 	// Default commander and all its services. This is an optional feature.
-	// _ "v2ray.com/core/app/commander"
-	// _ "v2ray.com/core/app/log/command"
+	// _ "github.com/v2fly/v2ray-core/v5/app/commander"
+	// _ "github.com/v2fly/v2ray-core/v5/app/log/command"
 
-	// _ "v2ray.com/core/app/proxyman/command"
-	// _ "v2ray.com/core/app/stats/command"
+	// _ "github.com/v2fly/v2ray-core/v5/app/proxyman/command"
+	// _ "github.com/v2fly/v2ray-core/v5/app/stats/command"
 
 	// Other optional features.
-	// _ "v2ray.com/core/app/dns"
-	// _ "v2ray.com/core/app/log"
-	// _ "v2ray.com/core/app/policy"
+	// _ "github.com/v2fly/v2ray-core/v5/app/dns"
+	// _ "github.com/v2fly/v2ray-core/v5/app/log"
+	// _ "github.com/v2fly/v2ray-core/v5/app/policy"
 
-	// _ "v2ray.com/core/app/reverse"
-	// _ "v2ray.com/core/app/router"
-	// _ "v2ray.com/core/app/stats"
+	// _ "github.com/v2fly/v2ray-core/v5/app/reverse"
+	// _ "github.com/v2fly/v2ray-core/v5/app/router"
+	// _ "github.com/v2fly/v2ray-core/v5/app/stats"
 
 	// Inbound and outbound proxies.
-	// _ "v2ray.com/core/proxy/blackhole"
-	// _ "v2ray.com/core/proxy/dns"
-	// _ "v2ray.com/core/proxy/dokodemo"
-	// _ "v2ray.com/core/proxy/freedom"
-	// _ "v2ray.com/core/proxy/http"
-
-	// _ "v2ray.com/core/proxy/mtproto"
-	// _ "v2ray.com/core/proxy/shadowsocks"
-	// _ "v2ray.com/core/proxy/socks"
-	// _ "v2ray.com/core/proxy/vmess/inbound"
-	_ "v2ray.com/core/proxy/vmess/outbound"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/blackhole"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/dns"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/dokodemo"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/freedom"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/http"
+
+	_ "github.com/v2fly/v2ray-core/v5/proxy/shadowsocks"
+	_ "github.com/v2fly/v2ray-core/v5/proxy/trojan"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/socks"
+	// _ "github.com/v2fly/v2ray-core/v5/proxy/vmess/inbound"
+	_ "github.com/v2fly/v2ray-core/v5/proxy/vless/outbound"
+	_ "github.com/v2fly/v2ray-core/v5/proxy/vmess/outbound"
 
 	// Transports
-	// _ "v2ray.com/core/transport/internet/domainsocket"
-	_ "v2ray.com/core/transport/internet/http"
-	_ "v2ray.com/core/transport/internet/kcp"
-	_ "v2ray.com/core/transport/internet/quic"
-	_ "v2ray.com/core/transport/internet/tcp"
-	_ "v2ray.com/core/transport/internet/tls"
-	_ "v2ray.com/core/transport/internet/udp"
-	_ "v2ray.com/core/transport/internet/websocket"
+	// _ "github.com/v2fly/v2ray-core/v5/transport/internet/domainsocket"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/grpc"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/http"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/kcp"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/quic"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/tcp"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/tls"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/udp"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/websocket"
 
 	// Transport headers
-	_ "v2ray.com/core/transport/internet/headers/http"
-	_ "v2ray.com/core/transport/internet/headers/noop"
-	_ "v2ray.com/core/transport/internet/headers/srtp"
-	_ "v2ray.com/core/transport/internet/headers/tls"
-	_ "v2ray.com/core/transport/internet/headers/utp"
-	_ "v2ray.com/core/transport/internet/headers/wechat"
-	_ "v2ray.com/core/transport/internet/headers/wireguard"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/http"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/noop"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/srtp"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/tls"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/utp"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/wechat"
+	_ "github.com/v2fly/v2ray-core/v5/transport/internet/headers/wireguard"
 )
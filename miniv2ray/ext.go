@@ -6,7 +6,7 @@ import (
 	"strings"
 	"time"
 
-	"v2ray.com/core"
+	"github.com/v2fly/v2ray-core/v5"
 )
 
 const (
@@ -14,7 +14,12 @@ const (
 )
 
 func GetNodeInfo(inst *core.Instance, timeout time.Duration) (map[string]string, error) {
-	code, bf, err := CoreHTTPRequest(inst, timeout, "GET", cloudflareCGI)
+	return GetNodeInfoTag(inst, "", timeout)
+}
+
+// GetNodeInfoTag gets the location and ip of the node behind the outbound of tag
+func GetNodeInfoTag(inst *core.Instance, tag string, timeout time.Duration) (map[string]string, error) {
+	code, bf, err := CoreHTTPRequestTag(inst, tag, timeout, "GET", cloudflareCGI)
 	if err != nil {
 		return nil, err
 	}
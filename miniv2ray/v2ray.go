@@ -11,34 +11,43 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/qjebbs/v2tool/vmess"
-	"v2ray.com/core"
-	"v2ray.com/core/app/dispatcher"
-	applog "v2ray.com/core/app/log"
-	"v2ray.com/core/app/proxyman"
-	commlog "v2ray.com/core/common/log"
-	v2net "v2ray.com/core/common/net"
-	"v2ray.com/core/common/serial"
-	"v2ray.com/core/infra/conf"
+	"github.com/v2fly/v2ray-core/v5"
+	"github.com/v2fly/v2ray-core/v5/app/dispatcher"
+	applog "github.com/v2fly/v2ray-core/v5/app/log"
+	"github.com/v2fly/v2ray-core/v5/app/proxyman"
+	commlog "github.com/v2fly/v2ray-core/v5/common/log"
+	v2net "github.com/v2fly/v2ray-core/v5/common/net"
+	"github.com/v2fly/v2ray-core/v5/common/serial"
+	"github.com/v2fly/v2ray-core/v5/common/session"
+	"github.com/v2fly/v2ray-core/v5/features/outbound"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon/muxcfg"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 func JSON2Outbound(f string, usemux bool) (*core.OutboundHandlerConfig, error) {
-	c := &conf.Config{}
 	data, err := ioutil.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(data, c)
+	return jsonBytes2Outbound(data, f, usemux)
+}
+
+func jsonBytes2Outbound(data []byte, src string, usemux bool) (*core.OutboundHandlerConfig, error) {
+	c := &conf.Config{}
+	err := json.Unmarshal(data, c)
 	if err != nil {
 		return nil, err
 	}
 	if c.OutboundConfigs == nil || len(c.OutboundConfigs) == 0 {
-		return nil, fmt.Errorf("no valid outbound found in %s", f)
+		return nil, fmt.Errorf("no valid outbound found in %s", src)
 	}
 	out := c.OutboundConfigs[0]
 	out.Tag = "proxy"
-	out.MuxSettings = &conf.MuxConfig{}
+	out.MuxSettings = &muxcfg.MuxConfig{}
 	if usemux {
 		out.MuxSettings.Enabled = true
 		out.MuxSettings.Concurrency = 8
@@ -56,36 +65,95 @@ func Vmess2Outbound(v *vmess.Link, usemux bool) (*core.OutboundHandlerConfig, er
 }
 
 func StartV2Ray(vm string, verbose, usemux bool) (*core.Instance, error) {
+	ob, err := Outbound(vm, usemux)
+	if err != nil {
+		return nil, err
+	}
+	return StartOutbound(ob, verbose)
+}
 
-	loglevel := commlog.Severity_Error
-	if verbose {
-		loglevel = commlog.Severity_Debug
+// Outbound builds the outbound of a share link, a json config, or a json config file
+func Outbound(vm string, usemux bool) (*core.OutboundHandlerConfig, error) {
+	if strings.HasPrefix(strings.TrimSpace(vm), "{") {
+		return jsonBytes2Outbound([]byte(vm), "json config", usemux)
 	}
-	var (
-		ob  *core.OutboundHandlerConfig
-		err error
-	)
-	var u *url.URL
-	if u, err = url.Parse(vm); err == nil && u.Scheme != "" {
-		lk, err := vmess.ParseVmess(vm)
+	if vmess.IsSupportedLink(vm) {
+		lk, err := vmess.ParseLink(vm)
 		if err != nil {
 			return nil, err
 		}
+		return Link2Outbound(lk, usemux)
+	}
+	if u, err := url.Parse(vm); err == nil && u.Scheme != "" {
+		lk, err := vmess.ParseLink(vm)
+		if err != nil {
+			return nil, err
+		}
+		return Link2Outbound(lk, usemux)
+	}
+	return JSON2Outbound(vm, usemux)
+}
 
-		fmt.Println("\n" + lk.DetailStr())
-		ob, err = Vmess2Outbound(lk, usemux)
-	} else {
-		ob, err = JSON2Outbound(vm, usemux)
+// Link2Outbound builds the outbound of a share link. If it fails, the field
+// errors of an invalid vmess link are returned, which tell more
+func Link2Outbound(lk vmess.ProxyLink, usemux bool) (*core.OutboundHandlerConfig, error) {
+	// links failing the validation may still be taken by the core, e.g.: unknown
+	// scy, which falls back to "auto"
+	var invalid vmess.FieldErrors
+	if l, ok := lk.(*vmess.Link); ok {
+		invalid = l.Validate()
 	}
+	out, err := lk.ToOutbound(usemux)
 	if err != nil {
+		if invalid != nil {
+			return nil, invalid
+		}
 		return nil, err
 	}
+	out.Tag = "proxy"
+	ob, err := out.Build()
+	if err != nil {
+		if invalid != nil {
+			return nil, invalid
+		}
+		return nil, fmt.Errorf("failed to build %s outbound, the protocol or transport may not be supported by v2ray-core %s: %v", lk.Protocol(), CoreVersion(), err)
+	}
+	return ob, nil
+}
+
+// StartOutbound creates a core instance with the given outbound,
+// without printing anything about the node
+func StartOutbound(ob *core.OutboundHandlerConfig, verbose bool) (*core.Instance, error) {
+	return StartOutbounds([]*core.OutboundHandlerConfig{ob}, verbose)
+}
+
+// StartOutbounds creates one core instance carrying all the outbounds.
+// Outbounds should have distinct tags, so that they can be selected by
+// CoreHTTPClientTag, MeasureDelayTag, etc. The first one is the default.
+func StartOutbounds(obs []*core.OutboundHandlerConfig, verbose bool) (*core.Instance, error) {
+	if len(obs) == 0 {
+		return nil, errors.New("no outbound to start")
+	}
+	tags := make(map[string]bool)
+	for _, ob := range obs {
+		if tags[ob.Tag] {
+			return nil, fmt.Errorf("duplicated outbound tag: %s", ob.Tag)
+		}
+		tags[ob.Tag] = true
+	}
+
+	loglevel := commlog.Severity_Error
+	if verbose {
+		loglevel = commlog.Severity_Debug
+	}
 
 	config := &core.Config{
-		App: []*serial.TypedMessage{
+		App: []*anypb.Any{
 			serial.ToTypedMessage(&applog.Config{
-				ErrorLogType:  applog.LogType_Console,
-				ErrorLogLevel: loglevel,
+				Error: &applog.LogSpecification{
+					Type:  applog.LogType_Console,
+					Level: loglevel,
+				},
 			}),
 			serial.ToTypedMessage(&dispatcher.Config{}),
 			serial.ToTypedMessage(&proxyman.InboundConfig{}),
@@ -94,7 +162,7 @@ func StartV2Ray(vm string, verbose, usemux bool) (*core.Instance, error) {
 	}
 
 	commlog.RegisterHandler(commlog.NewLogger(commlog.CreateStderrLogWriter()))
-	config.Outbound = []*core.OutboundHandlerConfig{ob}
+	config.Outbound = obs
 	server, err := core.New(config)
 	if err != nil {
 		return nil, err
@@ -104,8 +172,13 @@ func StartV2Ray(vm string, verbose, usemux bool) (*core.Instance, error) {
 }
 
 func MeasureDelay(inst *core.Instance, timeout time.Duration, dest string) (int64, error) {
+	return MeasureDelayTag(inst, "", timeout, dest)
+}
+
+// MeasureDelayTag measures the delay of a request sent through the outbound of tag
+func MeasureDelayTag(inst *core.Instance, tag string, timeout time.Duration, dest string) (int64, error) {
 	start := time.Now()
-	code, _, err := CoreHTTPRequest(inst, timeout, "GET", dest)
+	code, _, err := CoreHTTPRequestTag(inst, tag, timeout, "GET", dest)
 	if err != nil {
 		return -1, err
 	}
@@ -116,6 +189,12 @@ func MeasureDelay(inst *core.Instance, timeout time.Duration, dest string) (int6
 }
 
 func CoreHTTPClient(inst *core.Instance, timeout time.Duration) (*http.Client, error) {
+	return CoreHTTPClientTag(inst, "", timeout)
+}
+
+// CoreHTTPClientTag returns a http client which sends requests through
+// the outbound of tag, an empty tag selects the default outbound
+func CoreHTTPClientTag(inst *core.Instance, tag string, timeout time.Duration) (*http.Client, error) {
 
 	if inst == nil {
 		return nil, errors.New("core instance nil")
@@ -123,13 +202,7 @@ func CoreHTTPClient(inst *core.Instance, timeout time.Duration) (*http.Client, e
 
 	tr := &http.Transport{
 		DisableKeepAlives: true,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dest, err := v2net.ParseDestination(fmt.Sprintf("%s:%s", network, addr))
-			if err != nil {
-				return nil, err
-			}
-			return core.Dial(ctx, inst, dest)
-		},
+		DialContext:       CoreDialer(inst, tag),
 	}
 
 	c := &http.Client{
@@ -140,9 +213,43 @@ func CoreHTTPClient(inst *core.Instance, timeout time.Duration) (*http.Client, e
 	return c, nil
 }
 
+// CoreDialer returns a dial function which connects through the outbound of tag,
+// an empty tag selects the default outbound
+func CoreDialer(inst *core.Instance, tag string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dest, err := v2net.ParseDestination(fmt.Sprintf("%s:%s", network, addr))
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" {
+			return core.Dial(ctx, inst, dest)
+		}
+		return dialTag(ctx, inst, tag, dest)
+	}
+}
+
+// dialTag works like core.Dial, but forces the request to the outbound
+// handler of tag, instead of the routed one
+func dialTag(ctx context.Context, inst *core.Instance, tag string, dest v2net.Destination) (net.Conn, error) {
+	ohm, ok := inst.GetFeature(outbound.ManagerType()).(outbound.Manager)
+	if !ok {
+		return nil, errors.New("outbound.Manager is not registered in core")
+	}
+	// the dispatcher closes the link silently for an unknown tag
+	if ohm.GetHandler(tag) == nil {
+		return nil, fmt.Errorf("outbound not found: %s", tag)
+	}
+	return core.Dial(session.SetForcedOutboundTagToContext(ctx, tag), inst, dest)
+}
+
 func CoreHTTPRequest(inst *core.Instance, timeout time.Duration, method, dest string) (int, []byte, error) {
+	return CoreHTTPRequestTag(inst, "", timeout, method, dest)
+}
+
+// CoreHTTPRequestTag sends a request through the outbound of tag
+func CoreHTTPRequestTag(inst *core.Instance, tag string, timeout time.Duration, method, dest string) (int, []byte, error) {
 
-	c, err := CoreHTTPClient(inst, timeout)
+	c, err := CoreHTTPClientTag(inst, tag, timeout)
 	if err != nil {
 		return 0, nil, err
 	}
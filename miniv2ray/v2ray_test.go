@@ -0,0 +1,80 @@
+package miniv2ray
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/v2fly/v2ray-core/v5"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+	_ "github.com/v2fly/v2ray-core/v5/proxy/freedom"
+)
+
+// echoName starts a tcp server which replies its name to every line
+func echoName(t *testing.T, name string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+					fmt.Fprintln(conn, name)
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestStartOutboundsDialTag(t *testing.T) {
+	obs := make([]*core.OutboundHandlerConfig, 0, 2)
+	for _, tag := range []string{"a", "b"} {
+		l := echoName(t, tag)
+		defer l.Close()
+		// freedom redirects every request to the server of its tag
+		settings := json.RawMessage(fmt.Sprintf(`{"redirect":%q}`, l.Addr().String()))
+		ob, err := (&conf.OutboundDetourConfig{Protocol: "freedom", Tag: tag, Settings: &settings}).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		obs = append(obs, ob)
+	}
+	inst, err := StartOutbounds(obs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inst.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	// an empty tag selects the default, which is the first
+	for tag, want := range map[string]string{"a": "a", "b": "b", "": "a"} {
+		conn, err := CoreDialer(inst, tag)(context.Background(), "tcp", "example.com:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintln(conn, "hello")
+		got, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil {
+			t.Fatalf("tag %q: %v", tag, err)
+		}
+		if got != want+"\n" {
+			t.Errorf("tag %q: dialed %q, want %q", tag, got, want)
+		}
+	}
+	if _, err := CoreDialer(inst, "c")(context.Background(), "tcp", "example.com:80"); err == nil {
+		t.Error("want error for unknown tag")
+	}
+}
@@ -0,0 +1,136 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/v2fly/v2ray-core/v5"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// OutboundAPI applies outbound changes to a running v2ray,
+// which is implemented by *api.APIServer
+type OutboundAPI interface {
+	AddOutbounds(outbounds []*core.OutboundHandlerConfig) error
+	RemoveOutbounds(tags []string) error
+}
+
+// change is a file change made by Fetch
+type change struct {
+	file string
+	// old is the content before change, nil if the file is added
+	old []byte
+	// new is the content after change, nil if the file is removed
+	new []byte
+}
+
+// applyAPI reconciles the running v2ray with the file changes: outbounds of
+// updated and removed files are removed, and those of added and updated files
+// are added. If any outbound is rejected, the running v2ray is restored as
+// much as possible, and the error is returned, with the failures of restoring
+func applyAPI(a OutboundAPI, changes []*change) error {
+	type outbound struct {
+		tag    string
+		config *core.OutboundHandlerConfig
+	}
+	var olds, news []*outbound
+	collect := func(file string, content []byte, dst *[]*outbound) error {
+		if content == nil {
+			return nil
+		}
+		obs, err := buildOutbounds(content)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for _, ob := range obs {
+			*dst = append(*dst, &outbound{tag: ob.Tag, config: ob})
+		}
+		return nil
+	}
+	for _, c := range changes {
+		if err := collect(c.file, c.old, &olds); err != nil {
+			return err
+		}
+		if err := collect(c.file, c.new, &news); err != nil {
+			return err
+		}
+	}
+
+	removed := make([]*outbound, 0, len(olds))
+	for _, o := range olds {
+		if o.tag == "" {
+			continue
+		}
+		// the outbound may not be loaded by the running v2ray,
+		// which is not a reason to stop
+		if err := a.RemoveOutbounds([]string{o.tag}); err != nil {
+			fmt.Printf("Warning: failed to remove outbound %q: %v\n", o.tag, err)
+			continue
+		}
+		fmt.Printf("API removed: %s\n", o.tag)
+		removed = append(removed, o)
+	}
+	added := make([]string, 0, len(news))
+	for _, o := range news {
+		if err := a.AddOutbounds([]*core.OutboundHandlerConfig{o.config}); err != nil {
+			err = fmt.Errorf("outbound %q rejected by api: %v", o.tag, err)
+			// roll back the running v2ray, the failures are reported, since
+			// it would not match the files restored by the caller
+			failed := make([]string, 0)
+			if len(added) > 0 {
+				if rerr := a.RemoveOutbounds(added); rerr != nil {
+					failed = append(failed, fmt.Sprintf("remove %s: %v", strings.Join(added, ", "), rerr))
+				}
+			}
+			for _, r := range removed {
+				if rerr := a.AddOutbounds([]*core.OutboundHandlerConfig{r.config}); rerr != nil {
+					failed = append(failed, fmt.Sprintf("restore %s: %v", r.tag, rerr))
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("%v, and failed to roll back the running v2ray: %s", err, strings.Join(failed, "; "))
+			}
+			return err
+		}
+		fmt.Printf("API added: %s\n", o.tag)
+		added = append(added, o.tag)
+	}
+	return nil
+}
+
+// rollbackFiles restores the files to the content before changes
+func rollbackFiles(changes []*change) error {
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		var err error
+		if c.old == nil {
+			err = os.Remove(c.file)
+		} else {
+			err = ioutil.WriteFile(c.file, c.old, 0644)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("Restored:", c.file)
+	}
+	return nil
+}
+
+func buildOutbounds(content []byte) ([]*core.OutboundHandlerConfig, error) {
+	c := &conf.Config{}
+	if err := json.Unmarshal(content, c); err != nil {
+		return nil, err
+	}
+	obs := make([]*core.OutboundHandlerConfig, 0, len(c.OutboundConfigs))
+	for _, oc := range c.OutboundConfigs {
+		ob, err := oc.Build()
+		if err != nil {
+			return nil, err
+		}
+		obs = append(obs, ob)
+	}
+	return obs, nil
+}
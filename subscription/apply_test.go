@@ -0,0 +1,188 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qjebbs/v2tool/vmess"
+	"github.com/v2fly/v2ray-core/v5"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// fakeAPI records the running outbounds, and rejects the tag of reject
+type fakeAPI struct {
+	running map[string]bool
+	reject  string
+}
+
+func (a *fakeAPI) AddOutbounds(obs []*core.OutboundHandlerConfig) error {
+	for _, ob := range obs {
+		if ob.Tag == a.reject {
+			return errors.New("rejected")
+		}
+		a.running[ob.Tag] = true
+	}
+	return nil
+}
+
+func (a *fakeAPI) RemoveOutbounds(tags []string) error {
+	for _, tag := range tags {
+		delete(a.running, tag)
+	}
+	return nil
+}
+
+func (a *fakeAPI) tags() []string {
+	tags := make([]string, 0)
+	for _, tag := range []string{"sub - a", "sub - b", "stale"} {
+		if a.running[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func TestFetchAPI(t *testing.T) {
+	link := func(ps string) string {
+		return (&vmess.Link{Ver: "2", Add: ps + ".example.com", Port: "443", ID: "27b8a625-4f4b-4428-9f0f-8a2317db7c79", Aid: "0", Ps: ps, Net: "tcp", Type: "none"}).LinkStr("ng")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the vless link is skipped, since the core rejects its encryption
+		w.Write([]byte(link("a") + "\n" + link("b") + "\n" +
+			"vless://b831381d-6324-4d53-ad4f-8cda48b30811@c.example.com:443?encryption=auto#c\n"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "subscriptions.conf")
+	c, _ := json.Marshal(&Config{Subscriptions: []*Subscription{{Tag: "sub", URL: srv.URL}}})
+	stale := `{"outbounds":[{"tag":"stale","protocol":"freedom"}]}`
+
+	tests := []struct {
+		name    string
+		reject  string
+		want    []string
+		wantErr bool
+	}{
+		{"applied", "", []string{"sub - a", "sub - b"}, false},
+		{"rejected", "sub - b", []string{"stale"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outdir := filepath.Join(dir, tt.name)
+			os.MkdirAll(outdir, 0755)
+			ioutil.WriteFile(conf, c, 0644)
+			ioutil.WriteFile(filepath.Join(outdir, "stale.json"), []byte(stale), 0644)
+			a := &fakeAPI{running: map[string]bool{"stale": true}, reject: tt.reject}
+
+			err := Fetch(conf, outdir, &Options{Prune: true, API: a})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if d := cmp.Diff(tt.want, a.tags()); d != "" {
+				t.Errorf("running outbounds: %s", d)
+			}
+			files, _ := filepath.Glob(filepath.Join(outdir, "*.json"))
+			for i, f := range files {
+				files[i] = filepath.Base(f)
+			}
+			wantFiles := make([]string, 0)
+			for _, tag := range tt.want {
+				wantFiles = append(wantFiles, tag+".json")
+			}
+			if d := cmp.Diff(wantFiles, files); d != "" {
+				t.Errorf("files: %s", d)
+			}
+		})
+	}
+}
+
+// stuckAPI fails to remove any outbound
+type stuckAPI struct {
+	fakeAPI
+}
+
+func (a *stuckAPI) RemoveOutbounds(tags []string) error {
+	return errors.New("stuck")
+}
+
+func TestApplyAPIRollbackFailure(t *testing.T) {
+	content := func(tag string) []byte {
+		return []byte(`{"outbounds":[{"tag":"` + tag + `","protocol":"freedom"}]}`)
+	}
+	changes := []*change{
+		{file: "sub - a.json", new: content("sub - a")},
+		{file: "sub - b.json", new: content("sub - b")},
+	}
+	a := &stuckAPI{fakeAPI{running: map[string]bool{}, reject: "sub - b"}}
+	err := applyAPI(a, changes)
+	want := `outbound "sub - b" rejected by api: rejected, and failed to roll back the running v2ray: remove sub - a: stuck`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestSyncFilesRollbackLatency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	results := []*result{{
+		cands: []*candidate{{
+			name:     "a",
+			sub:      "sub",
+			id:       "1111111111111111",
+			out:      &conf.OutboundDetourConfig{Tag: "sub - a", Protocol: "freedom"},
+			filename: "sub - a.json",
+			content:  []byte(`{"outbounds":[{"tag":"sub - a","protocol":"freedom"}]}`),
+		}},
+		records: []*latencyRecord{{ID: "1111111111111111", Passed: true}},
+	}}
+	tests := []struct {
+		name string
+		// old is the latency file before sync, nil if not exist
+		old []byte
+	}{
+		{"restored", []byte("old\n")},
+		{"removed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outdir := filepath.Join(dir, tt.name)
+			os.MkdirAll(outdir, 0755)
+			latency := filepath.Join(outdir, latencyFile)
+			if tt.old != nil {
+				ioutil.WriteFile(latency, tt.old, 0644)
+			}
+			a := &fakeAPI{running: map[string]bool{}, reject: "sub - a"}
+			if _, err := syncFiles(outdir, results, nil, &Options{API: a}, false); err == nil {
+				t.Fatal("want error")
+			}
+			got, err := ioutil.ReadFile(latency)
+			if tt.old == nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("latency file should be removed, got %q, %v", got, err)
+				}
+				return
+			}
+			if string(got) != string(tt.old) {
+				t.Errorf("got latency file %q, want %q", got, tt.old)
+			}
+			if _, err := os.Stat(filepath.Join(outdir, "sub - a.json")); !os.IsNotExist(err) {
+				t.Errorf("outbound file should be removed, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package subscription
+
+import (
+	"fmt"
+
+	"github.com/qjebbs/v2tool/vmess"
+)
+
+// policies of Dedup
+const (
+	// DedupAll keeps the outbounds of all subscriptions
+	DedupAll = "all"
+	// DedupFirst keeps the outbound of the first subscription in config
+	DedupFirst = "first"
+	// DedupPrefer keeps the outbound of the first subscription in
+	// Dedup.Prefer, or in config if none of them has it
+	DedupPrefer = "prefer"
+)
+
+// Dedup merges the same servers resold by more than one subscription
+type Dedup struct {
+	// Policy is one of "all", "first" and "prefer", defaults to "all"
+	Policy string `json:"policy,omitempty"`
+	// Prefer is the tags of preferred subscriptions, in priority order
+	Prefer []string `json:"prefer,omitempty"`
+}
+
+func (d *Dedup) validate() error {
+	if d == nil {
+		return nil
+	}
+	switch d.Policy {
+	case "", DedupAll, DedupFirst:
+	case DedupPrefer:
+		if len(d.Prefer) == 0 {
+			return fmt.Errorf("dedup policy %q requires the preferred subscriptions", d.Policy)
+		}
+	default:
+		return fmt.Errorf("unknown dedup policy: %s", d.Policy)
+	}
+	return nil
+}
+
+// sameServer tests if two candidates connect to the same server. Vmess links
+// are compared by IsEqual, which normalizes them like identity() does, others
+// by the identity
+func sameServer(a, b *candidate) bool {
+	if a.id == b.id {
+		return true
+	}
+	la, ok := a.link.(*vmess.Link)
+	if !ok {
+		return false
+	}
+	lb, ok := b.link.(*vmess.Link)
+	return ok && la.IsEqual(lb)
+}
+
+// dedup removes the candidates of a server from all subscriptions but the one
+// chosen by the policy, the results are copied, not changed. It returns the
+// deduplicated results and the count of merged candidates.
+func dedup(results []*result, d *Dedup) ([]*result, int) {
+	if d == nil || d.Policy == "" || d.Policy == DedupAll {
+		return results, 0
+	}
+	// rank is the priority of subscriptions, lower is preferred
+	rank := make(map[string]int)
+	if d.Policy == DedupPrefer {
+		for _, tag := range d.Prefer {
+			if _, ok := rank[tag]; !ok {
+				rank[tag] = len(rank)
+			}
+		}
+	}
+	for _, r := range results {
+		for _, c := range r.cands {
+			if _, ok := rank[c.sub]; !ok {
+				rank[c.sub] = len(rank)
+			}
+		}
+	}
+	all := make([]*candidate, 0)
+	for _, r := range results {
+		all = append(all, r.cands...)
+	}
+	// kept is the candidate kept for the server of each candidate
+	kept := make(map[*candidate]*candidate)
+	for _, c := range all {
+		kept[c] = c
+		for _, o := range all {
+			if o.sub == c.sub || !sameServer(c, o) {
+				continue
+			}
+			if rank[o.sub] < rank[kept[c].sub] {
+				kept[c] = o
+			}
+		}
+	}
+	merged := 0
+	deduped := make([]*result, 0, len(results))
+	for _, r := range results {
+		nr := &result{cands: make([]*candidate, 0, len(r.cands)), records: r.records}
+		for _, c := range r.cands {
+			if k := kept[c]; k != c {
+				fmt.Printf("Merged: [%s] %s -> [%s] %s\n", c.sub, c.name, k.sub, k.name)
+				merged++
+				continue
+			}
+			nr.cands = append(nr.cands, c)
+		}
+		deduped = append(deduped, nr)
+	}
+	return deduped, merged
+}
@@ -0,0 +1,78 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qjebbs/v2tool/vmess"
+)
+
+func TestDedup(t *testing.T) {
+	cand := func(sub, name string, port interface{}, aid interface{}) *candidate {
+		link := &vmess.Link{Add: "example.com", Port: port, ID: "27b8a625-4f4b-4428-9f0f-8a2317db7c79", Aid: aid, Ps: name}
+		// identities differ with the port types, like links of different providers
+		return &candidate{name: name, sub: sub, id: sub + name, link: link}
+	}
+	results := func() []*result {
+		return []*result{
+			{cands: []*candidate{cand("a", "1", "443", "0"), cand("a", "2", "8443", "0")}},
+			{cands: []*candidate{cand("b", "1", 443, 0), cand("b", "2", 8443, 4)}},
+			{cands: []*candidate{cand("c", "1", float64(443), nil)}},
+		}
+	}
+	tests := []struct {
+		name       string
+		dedup      *Dedup
+		want       []string
+		wantMerged int
+	}{
+		{"nil", nil, []string{"a/1", "a/2", "b/1", "b/2", "c/1"}, 0},
+		{"all", &Dedup{Policy: DedupAll}, []string{"a/1", "a/2", "b/1", "b/2", "c/1"}, 0},
+		{"first", &Dedup{Policy: DedupFirst}, []string{"a/1", "a/2", "b/2"}, 2},
+		{"prefer", &Dedup{Policy: DedupPrefer, Prefer: []string{"c"}}, []string{"a/2", "b/2", "c/1"}, 2},
+		{"prefer fallback", &Dedup{Policy: DedupPrefer, Prefer: []string{"x", "b"}}, []string{"a/2", "b/1", "b/2"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := results()
+			deduped, merged := dedup(rs, tt.dedup)
+			got := make([]string, 0)
+			for _, r := range deduped {
+				for _, c := range r.cands {
+					got = append(got, c.sub+"/"+c.name)
+				}
+			}
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+			if merged != tt.wantMerged {
+				t.Errorf("got %d merged, want %d", merged, tt.wantMerged)
+			}
+			if n := len(rs[0].cands) + len(rs[1].cands) + len(rs[2].cands); n != 5 {
+				t.Errorf("results changed, got %d candidates", n)
+			}
+		})
+	}
+}
+
+func TestDedupValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dedup   *Dedup
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &Dedup{}, false},
+		{"first", &Dedup{Policy: DedupFirst}, false},
+		{"prefer", &Dedup{Policy: DedupPrefer, Prefer: []string{"a"}}, false},
+		{"prefer none", &Dedup{Policy: DedupPrefer}, true},
+		{"unknown", &Dedup{Policy: "last"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.dedup.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package subscription
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// unifiedDiff returns the unified diff between the old and new content of
+// a json file, nil content stands for a file not existing. The json is
+// indented before comparing, so that the diff is readable
+func unifiedDiff(name string, old, new []byte) string {
+	from, to := "a/"+name, "b/"+name
+	if old == nil {
+		from = "/dev/null"
+	}
+	if new == nil {
+		to = "/dev/null"
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        jsonLines(old),
+		B:        jsonLines(new),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
+	})
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	return diff
+}
+
+// jsonLines splits the indented json into lines
+func jsonLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, data, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(data)
+	}
+	return difflib.SplitLines(strings.TrimSuffix(buf.String(), "\n"))
+}
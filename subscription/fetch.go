@@ -0,0 +1,155 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	mv2ray "github.com/qjebbs/v2tool/miniv2ray"
+	"github.com/qjebbs/v2tool/vmess"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Links downloads and parses links of the subscription
+func Links(sub *Subscription) ([]vmess.ProxyLink, error) {
+	body, err := Download(sub)
+	if err != nil {
+		return nil, err
+	}
+	return vmess.LinksFromContent(body)
+}
+
+// Download downloads the content of the subscription, with the fetch options
+// of it, e.g.: through an outbound or a proxy, with custom headers, etc.
+func Download(sub *Subscription) ([]byte, error) {
+	body, _, err := download(sub, nil)
+	return body, err
+}
+
+// bodyCache is the last downloaded body of a subscription, with the
+// validators to make conditional requests
+type bodyCache struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// download downloads the subscription, conditionally if cache is not nil,
+// in which case modified is false if the server responds 304, and the body
+// is the cached one
+func download(sub *Subscription, cache *bodyCache) (body []byte, modified bool, err error) {
+	client, closer, err := newClient(sub)
+	if err != nil {
+		return nil, false, err
+	}
+	if closer != nil {
+		defer closer()
+	}
+	for i := 0; i <= sub.Retry; i++ {
+		if i > 0 {
+			fmt.Printf("Retry %d/%d: %v\n", i, sub.Retry, err)
+			time.Sleep(time.Duration(i) * time.Second)
+		}
+		body, modified, err = get(client, sub, cache)
+		if err == nil {
+			return body, modified, nil
+		}
+	}
+	return nil, false, err
+}
+
+func get(client *http.Client, sub *Subscription, cache *bodyCache) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, sub.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range sub.Headers {
+		req.Header.Set(k, v)
+	}
+	if sub.UserAgent != "" {
+		req.Header.Set("User-Agent", sub.UserAgent)
+	}
+	if cache != nil && cache.body != nil {
+		if cache.etag != "" {
+			req.Header.Set("If-None-Match", cache.etag)
+		}
+		if cache.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.lastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cache != nil && cache.body != nil {
+		return cache.body, false, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if len(body) == 0 {
+		return nil, false, errors.New("empty subscription, the provider may require a different user agent")
+	}
+	if cache != nil {
+		cache.etag = resp.Header.Get("ETag")
+		cache.lastModified = resp.Header.Get("Last-Modified")
+		cache.body = body
+	}
+	return body, true, nil
+}
+
+// newClient creates the http client of the subscription, closer
+// should be called after use if it's not nil
+func newClient(sub *Subscription) (client *http.Client, closer func(), err error) {
+	timeout := defaultTimeout
+	if sub.Timeout > 0 {
+		timeout = time.Duration(sub.Timeout) * time.Second
+	}
+	switch {
+	case sub.Outbound != "" && sub.Proxy != "":
+		return nil, nil, errors.New("outbound and proxy cannot be both specified")
+	case sub.Outbound != "":
+		ob, err := mv2ray.Outbound(sub.Outbound, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		server, err := mv2ray.StartOutbound(ob, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := server.Start(); err != nil {
+			return nil, nil, fmt.Errorf("failed to start: %v", err)
+		}
+		client, err := mv2ray.CoreHTTPClient(server, timeout)
+		if err != nil {
+			server.Close()
+			return nil, nil, err
+		}
+		return client, func() { server.Close() }, nil
+	case sub.Proxy != "":
+		u, err := url.Parse(sub.Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, nil, fmt.Errorf("unsupported proxy: %s, should be http, https or socks5", sub.Proxy)
+		}
+		tr := &http.Transport{
+			Proxy:             http.ProxyURL(u),
+			DisableKeepAlives: true,
+		}
+		return &http.Client{Transport: tr, Timeout: timeout}, nil, nil
+	}
+	return &http.Client{Timeout: timeout}, nil, nil
+}
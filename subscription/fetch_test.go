@@ -0,0 +1,81 @@
+package subscription
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const links = "trojan://pass@example.com:443#trojan\n"
+
+func TestDownload(t *testing.T) {
+	fails := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ua":
+			if r.UserAgent() != "clash" || r.Header.Get("X-Token") != "token" {
+				return
+			}
+		case "/flaky":
+			if fails < 2 {
+				fails++
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		}
+		w.Write([]byte(links))
+	}))
+	defer srv.Close()
+	// a http proxy, which requests the target itself
+	proxied := false
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name    string
+		sub     *Subscription
+		wantErr string
+	}{
+		{"plain", &Subscription{URL: srv.URL}, ""},
+		{"no ua", &Subscription{URL: srv.URL + "/ua"}, "empty subscription"},
+		{"ua and headers", &Subscription{URL: srv.URL + "/ua", UserAgent: "clash", Headers: map[string]string{"X-Token": "token"}}, ""},
+		{"no retry", &Subscription{URL: srv.URL + "/flaky"}, "502"},
+		{"retry", &Subscription{URL: srv.URL + "/flaky", Retry: 2}, ""},
+		{"proxy", &Subscription{URL: srv.URL, Proxy: proxy.URL}, ""},
+		{"bad proxy", &Subscription{URL: srv.URL, Proxy: "ftp://127.0.0.1"}, "unsupported proxy"},
+		{"outbound", &Subscription{URL: srv.URL, Outbound: `{"outbounds": [{"protocol": "freedom"}]}`}, ""},
+		{"outbound and proxy", &Subscription{URL: srv.URL, Outbound: "{}", Proxy: proxy.URL}, "both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Download(tt.sub)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != links {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+	if !proxied {
+		t.Error("request not sent through proxy")
+	}
+}
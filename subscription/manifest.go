@@ -0,0 +1,195 @@
+package subscription
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/qjebbs/v2tool/vmess"
+)
+
+// manifestFile is the file in outdir, which maps the identities of outbounds
+// to their files and tags. Like latencyFile, it's not a json file
+const manifestFile = "manifest.jsonl"
+
+// manifestEntry is a line of the manifest file
+type manifestEntry struct {
+	ID           string `json:"id"`
+	Subscription string `json:"subscription"`
+	Tag          string `json:"tag"`
+	File         string `json:"file"`
+}
+
+// identity returns the identity of a link, which is derived from the
+// normalized connection fields only, so that it doesn't change with the
+// remarks, or with the forms of the same value, like port "443" and 443
+func identity(link vmess.ProxyLink) (string, error) {
+	or := func(s, def string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	}
+	var fields interface{}
+	switch l := link.(type) {
+	case *vmess.Link:
+		fields = l.Normalized()
+	case *vmess.VlessLink:
+		v := *l
+		v.Ps, v.OrigLink = "", ""
+		v.Net, v.Encryption = or(v.Net, "tcp"), or(v.Encryption, "none")
+		fields = v
+	case *vmess.TrojanLink:
+		v := *l
+		v.Ps, v.OrigLink = "", ""
+		v.Net, v.TLS = or(v.Net, "tcp"), or(v.TLS, "tls")
+		fields = v
+	case *vmess.SSLink:
+		v := *l
+		v.Ps, v.OrigLink = "", ""
+		fields = v
+	default:
+		return "", fmt.Errorf("unknown link type: %T", link)
+	}
+	b, err := json.Marshal([]interface{}{link.Protocol(), fields})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+func manifestKey(sub, id string) string {
+	return sub + "/" + id
+}
+
+// readManifest reads the manifest of outdir, keyed by manifestKey
+func readManifest(outdir string) (map[string]*manifestEntry, error) {
+	entries := make(map[string]*manifestEntry)
+	data, err := ioutil.ReadFile(filepath.Join(outdir, manifestFile))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		e := &manifestEntry{}
+		if err := json.Unmarshal(line, e); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		entries[manifestKey(e.Subscription, e.ID)] = e
+	}
+	return entries, scanner.Err()
+}
+
+func writeManifest(outdir string, entries []*manifestEntry) error {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(outdir, manifestFile), buf.Bytes(), 0644)
+}
+
+// assignNames decides the tags and file names of candidates, and returns
+// the candidates to write with the manifest of them:
+//
+// 1. An outbound keeps the tag in the previous manifest, so that renaming
+// of remarks is not taken as removing and adding.
+// 2. Other outbounds are tagged with "subscription - remarks". If the tag
+// is wanted by more than one outbound, or is kept by another one, the
+// identity is appended, so that the result doesn't rely on the order of
+// links.
+// 3. Previous entries without candidates are kept if keep returns true,
+// e.g. the node failed the probe but its file is not pruned, and their tags
+// are not given to others, so that the node gets its tag back later.
+//
+// Outbounds of the same identity in a subscription are written only once.
+func assignNames(results []*result, prev map[string]*manifestEntry, keep func(*manifestEntry) bool, socketMark int32) ([]*candidate, []*manifestEntry, error) {
+	cands := make([]*candidate, 0)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, c := range r.cands {
+			key := manifestKey(c.sub, c.id)
+			if seen[key] {
+				fmt.Printf("Duplicate: %s (same as another node of %s)\n", c.name, c.sub)
+				continue
+			}
+			seen[key] = true
+			cands = append(cands, c)
+		}
+	}
+
+	tags := make([]string, len(cands))
+	taken := make(map[string]bool)
+	kept := make([]*manifestEntry, 0)
+	for key, e := range prev {
+		if !seen[key] && keep != nil && keep(e) {
+			kept = append(kept, e)
+			taken[e.Tag] = true
+		}
+	}
+	for i, c := range cands {
+		if e, ok := prev[manifestKey(c.sub, c.id)]; ok && !taken[e.Tag] {
+			tags[i] = e.Tag
+			taken[e.Tag] = true
+		}
+	}
+	wanted := make(map[string]int)
+	for i, c := range cands {
+		if tags[i] == "" {
+			wanted[c.out.Tag]++
+		}
+	}
+	for i, c := range cands {
+		if tags[i] != "" {
+			continue
+		}
+		tag := c.out.Tag
+		if wanted[tag] > 1 || taken[tag] {
+			tag = fmt.Sprintf("%s %s", tag, c.id[:6])
+		}
+		for n := 2; taken[tag]; n++ {
+			tag = fmt.Sprintf("%s %s (%d)", c.out.Tag, c.id[:6], n)
+		}
+		tags[i] = tag
+		taken[tag] = true
+	}
+
+	manifest := make([]*manifestEntry, 0, len(cands)+len(kept))
+	manifest = append(manifest, kept...)
+	for i, c := range cands {
+		if c.out.Tag != tags[i] {
+			c.out.Tag = tags[i]
+			content, err := outbound2JSON(c.out, socketMark)
+			if err != nil {
+				return nil, nil, err
+			}
+			c.content = content
+		}
+		c.filename = tags[i] + ".json"
+		manifest = append(manifest, &manifestEntry{
+			ID:           c.id,
+			Subscription: c.sub,
+			Tag:          tags[i],
+			File:         c.filename,
+		})
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].File < manifest[j].File })
+	return cands, manifest, nil
+}
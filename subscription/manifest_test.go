@@ -0,0 +1,231 @@
+package subscription
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qjebbs/v2tool/vmess"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+func TestAssignNames(t *testing.T) {
+	cand := func(name, id string) *candidate {
+		return &candidate{name: name, sub: "sub", id: id + "0000000000", out: &conf.OutboundDetourConfig{Tag: "sub - " + name}}
+	}
+	entry := func(id, tag string) *manifestEntry {
+		return &manifestEntry{ID: id + "0000000000", Subscription: "sub", Tag: tag, File: tag + ".json"}
+	}
+	tests := []struct {
+		name  string
+		cands []*candidate
+		prev  []*manifestEntry
+		// want is the tag of each identity
+		want map[string]string
+	}{
+		{
+			"unique",
+			[]*candidate{cand("a", "111111"), cand("b", "222222")},
+			nil,
+			map[string]string{"111111": "sub - a", "222222": "sub - b"},
+		},
+		{
+			"duplicate tags",
+			[]*candidate{cand("a", "111111"), cand("a", "222222")},
+			nil,
+			map[string]string{"111111": "sub - a 111111", "222222": "sub - a 222222"},
+		},
+		{
+			"duplicate tags reordered",
+			[]*candidate{cand("a", "222222"), cand("a", "111111")},
+			nil,
+			map[string]string{"111111": "sub - a 111111", "222222": "sub - a 222222"},
+		},
+		{
+			"renamed",
+			[]*candidate{cand("new name", "111111")},
+			[]*manifestEntry{entry("111111", "sub - a")},
+			map[string]string{"111111": "sub - a"},
+		},
+		{
+			"tag kept by another",
+			[]*candidate{cand("a", "222222"), cand("b", "111111")},
+			[]*manifestEntry{entry("111111", "sub - a")},
+			map[string]string{"111111": "sub - a", "222222": "sub - a 222222"},
+		},
+		{
+			"same identity",
+			[]*candidate{cand("a", "111111"), cand("b", "111111")},
+			nil,
+			map[string]string{"111111": "sub - a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := make(map[string]*manifestEntry)
+			for _, e := range tt.prev {
+				prev[manifestKey(e.Subscription, e.ID)] = e
+			}
+			cands, manifest, err := assignNames([]*result{{cands: tt.cands}}, prev, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, c := range cands {
+				got[c.id[:6]] = c.out.Tag
+				if c.filename != c.out.Tag+".json" {
+					t.Errorf("got file %s of tag %s", c.filename, c.out.Tag)
+				}
+			}
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+			if len(manifest) != len(cands) {
+				t.Errorf("got %d manifest entries, want %d", len(manifest), len(cands))
+			}
+		})
+	}
+}
+
+func TestSyncFilesKeepManifest(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outdir)
+	cand := func(name, id string) *candidate {
+		out := &conf.OutboundDetourConfig{Tag: "sub - " + name, Protocol: "freedom"}
+		content, err := outbound2JSON(out, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &candidate{name: name, sub: "sub", id: id + "0000000000", out: out, filename: out.Tag + ".json", content: content}
+	}
+	sync := func(prune bool, cands ...*candidate) map[string]string {
+		if _, err := syncFiles(outdir, []*result{{cands: cands}}, nil, &Options{}, prune); err != nil {
+			t.Fatal(err)
+		}
+		m, err := readManifest(outdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, e := range m {
+			got[e.ID[:6]] = e.Tag
+		}
+		return got
+	}
+	steps := []struct {
+		name  string
+		prune bool
+		cands []*candidate
+		want  map[string]string
+	}{
+		{"init", false, []*candidate{cand("a", "111111"), cand("b", "222222")}, map[string]string{"111111": "sub - a", "222222": "sub - b"}},
+		// e.g.: b failed the probe, and a new node wants its tag
+		{"missing", false, []*candidate{cand("a", "111111"), cand("b", "333333")}, map[string]string{"111111": "sub - a", "222222": "sub - b", "333333": "sub - b 333333"}},
+		{"back", false, []*candidate{cand("a", "111111"), cand("b renamed", "222222")}, map[string]string{"111111": "sub - a", "222222": "sub - b", "333333": "sub - b 333333"}},
+		{"pruned", true, []*candidate{cand("a", "111111")}, map[string]string{"111111": "sub - a"}},
+	}
+	for _, st := range steps {
+		if d := cmp.Diff(st.want, sync(st.prune, st.cands...)); d != "" {
+			t.Errorf("%s: %s", st.name, d)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	parse := func(s string) vmess.ProxyLink {
+		l, err := vmess.ParseLink(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	id := "27b8a625-4f4b-4428-9f0f-8a2317db7c79"
+	tests := []struct {
+		name string
+		a, b vmess.ProxyLink
+		same bool
+	}{
+		{
+			"vmess defaults",
+			&vmess.Link{Add: "example.com", Port: "443", ID: id, Aid: "0", Ps: "a"},
+			&vmess.Link{Ver: "2", Add: "example.com", Port: float64(443), ID: id, Aid: nil, Net: "tcp", Type: "none", Scy: "auto", Ps: "b"},
+			true,
+		},
+		{
+			"vmess port",
+			&vmess.Link{Add: "example.com", Port: 443, ID: id},
+			&vmess.Link{Add: "example.com", Port: 8443, ID: id},
+			false,
+		},
+		{
+			"vless remarks and encryption",
+			parse("vless://" + id + "@example.com:443?type=ws&path=%2Fws#a"),
+			parse("vless://" + id + "@example.com:443?encryption=none&type=ws&path=%2Fws#b"),
+			true,
+		},
+		{
+			"vless and trojan",
+			parse("vless://" + id + "@example.com:443?security=tls"),
+			parse("trojan://" + id + "@example.com:443"),
+			false,
+		},
+		{
+			"trojan transport",
+			parse("trojan://password@example.com:443#a"),
+			parse("trojan://password@example.com:443?type=ws&path=%2Fws#a"),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := identity(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := identity(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("got identities %s and %s, want same: %v", a, b, tt.same)
+			}
+			if va, ok := tt.a.(*vmess.Link); ok && va.IsEqual(tt.b.(*vmess.Link)) != tt.same {
+				t.Errorf("identity disagrees with IsEqual")
+			}
+		})
+	}
+}
+
+func TestManifestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	got, err := readManifest(dir)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("want empty manifest, got %v, %v", got, err)
+	}
+	entries := []*manifestEntry{
+		{ID: "1111111111111111", Subscription: "sub", Tag: "sub - a", File: "sub - a.json"},
+		{ID: "2222222222222222", Subscription: "other", Tag: "other - b", File: "other - b.json"},
+	}
+	if err := writeManifest(dir, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err = readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*manifestEntry{
+		"sub/1111111111111111":   entries[0],
+		"other/2222222222222222": entries[1],
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,124 @@
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/qjebbs/v2tool/vmessping"
+)
+
+// latencyFile is the sidecar file in outdir, which records the probe
+// results of the last fetch. It's not a json file, so that it's never
+// taken as an outbound config
+const latencyFile = "latency.jsonl"
+
+// Probe is the health check of subscription links, links failed the
+// check are not written to outdir
+type Probe struct {
+	// Dest is the test destination url, need 204 for success return
+	Dest string `json:"dest,omitempty"`
+	// Count is the requests made to each node, defaults to 3
+	Count uint `json:"count,omitempty"`
+	// MinSuccess is the least successful requests to pass, defaults to 1
+	MinSuccess uint `json:"minSuccess,omitempty"`
+	// MaxLatencyMs is the max average latency to pass, 0 for no limit
+	MaxLatencyMs uint `json:"maxLatencyMs,omitempty"`
+	// Timeout is the timeout of each request in seconds, defaults to 10
+	Timeout uint `json:"timeout,omitempty"`
+	// Workers is the count of nodes probed concurrently, defaults to 8
+	Workers uint `json:"workers,omitempty"`
+}
+
+// latencyRecord is a line of the latency sidecar file
+type latencyRecord struct {
+	ID     string              `json:"id"`
+	File   string              `json:"file"`
+	Passed bool                `json:"passed"`
+	Error  string              `json:"error,omitempty"`
+	Stat   *vmessping.PingStat `json:"stat,omitempty"`
+}
+
+// probe pings the candidates concurrently, returns the passed ones
+// and the records of all
+func probe(p *Probe, cands []*candidate) ([]*candidate, []*latencyRecord, error) {
+	opts := &vmessping.Options{
+		Count:   3,
+		Dest:    "http://www.google.com/gen_204",
+		Timeout: 10 * time.Second,
+	}
+	if p.Dest != "" {
+		opts.Dest = p.Dest
+	}
+	if p.Count > 0 {
+		opts.Count = p.Count
+	}
+	if p.Timeout > 0 {
+		opts.Timeout = time.Duration(p.Timeout) * time.Second
+	}
+	minSuccess, workers := p.MinSuccess, p.Workers
+	if minSuccess == 0 {
+		minSuccess = 1
+	}
+	if workers == 0 {
+		workers = 8
+	}
+	nodes := make([]*vmessping.Node, 0, len(cands))
+	for _, c := range cands {
+		nodes = append(nodes, &vmessping.Node{Name: c.name, Vmess: string(c.content)})
+	}
+	results, err := vmessping.PingMany(context.Background(), nodes, workers, opts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// there's one result for each candidate, in the same order
+	passed := make([]*candidate, 0, len(cands))
+	records := make([]*latencyRecord, 0, len(cands))
+	for i, r := range results {
+		c := cands[i]
+		rec := &latencyRecord{ID: c.id, File: c.filename, Stat: r.Stat}
+		switch {
+		case r.Err != nil:
+			rec.Error = r.Err.Error()
+		case uint(len(r.Stat.Delays)) < minSuccess:
+			rec.Error = fmt.Sprintf("%d of %d requests succeeded, %d required", len(r.Stat.Delays), r.Stat.ReqCounter, minSuccess)
+		case p.MaxLatencyMs > 0 && r.Stat.AvgMs > p.MaxLatencyMs:
+			rec.Error = fmt.Sprintf("average latency %dms exceeds %dms", r.Stat.AvgMs, p.MaxLatencyMs)
+		default:
+			rec.Passed = true
+			passed = append(passed, c)
+			fmt.Printf("Healthy: %s (%dms)\n", c.name, r.Stat.AvgMs)
+		}
+		if !rec.Passed {
+			fmt.Printf("Unhealthy: %s (%s)\n", c.name, rec.Error)
+		}
+		records = append(records, rec)
+	}
+	return passed, records, nil
+}
+
+// writeLatency writes the probe records to the sidecar file of outdir,
+// and returns the change made to it
+func writeLatency(outdir string, records []*latencyRecord) (*change, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	file := filepath.Join(outdir, latencyFile)
+	old, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return &change{file: file, old: old, new: buf.Bytes()}, nil
+}
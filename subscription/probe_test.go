@@ -0,0 +1,55 @@
+package subscription
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProbe(t *testing.T) {
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer dest.Close()
+
+	cands := []*candidate{
+		{name: "direct", filename: "direct.json", content: []byte(`{"outbounds":[{"protocol":"freedom"}]}`)},
+		{name: "dead", filename: "dead.json", content: []byte(`{"outbounds":[{"protocol":"vmess","settings":{"vnext":[{"address":"127.0.0.1","port":1,"users":[{"id":"27b8a625-4f4b-4428-9f0f-8a2317db7c79"}]}]}}]}`)},
+		{name: "broken", filename: "broken.json", content: []byte(`{"outbounds":[{"protocol":"unknown"}]}`)},
+	}
+	passed, records, err := probe(&Probe{Dest: dest.URL, Count: 2, MinSuccess: 2, Timeout: 1}, cands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range passed {
+		names = append(names, c.name)
+	}
+	if d := cmp.Diff([]string{"direct"}, names); d != "" {
+		t.Error(d)
+	}
+	if len(records) != len(cands) {
+		t.Fatalf("got %d records, want %d", len(records), len(cands))
+	}
+	for i, r := range records {
+		if r.File != cands[i].filename {
+			t.Errorf("record %d: got file %s", i, r.File)
+		}
+		if r.Passed != (i == 0) || (r.Error == "") != r.Passed {
+			t.Errorf("record %d: passed %v, error %q", i, r.Passed, r.Error)
+		}
+	}
+	if records[0].Stat == nil || records[0].Stat.ReqCounter != 2 {
+		t.Errorf("want stat of 2 requests, got %+v", records[0].Stat)
+	}
+
+	passed, _, err = probe(&Probe{Dest: dest.URL, Count: 1, MaxLatencyMs: 5000}, cands[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passed) != 1 {
+		t.Error("direct should pass the latency limit")
+	}
+}
@@ -0,0 +1,466 @@
+// Package subscription fetches subscriptions and generates outbound json files
+package subscription
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qjebbs/v2tool/files"
+	"github.com/qjebbs/v2tool/vmess"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon/socketcfg"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// Subscription represents a subscription config
+type Subscription struct {
+	Tag    string `json:"tag"`
+	URL    string `json:"url"`
+	Ignore string `json:"ignore"`
+	Match  string `json:"match"`
+
+	// Outbound fetches the subscription through an outbound, which is a
+	// share link, a json config, or the path of a json config file
+	Outbound string `json:"outbound,omitempty"`
+	// Proxy fetches the subscription through a http or socks5 proxy,
+	// e.g.: socks5://127.0.0.1:1080
+	Proxy     string            `json:"proxy,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Timeout is the timeout of each request in seconds, defaults to 30
+	Timeout int `json:"timeout,omitempty"`
+	// Retry is the max times to retry when the fetch fails
+	Retry int `json:"retry,omitempty"`
+	// Probe pings the links before writing, only healthy ones are written
+	Probe *Probe `json:"probe,omitempty"`
+	// Interval is the refresh interval in seconds of Watch
+	Interval int `json:"interval,omitempty"`
+}
+
+// Config represents a subscription json
+type Config struct {
+	Subscriptions []*Subscription `json:"subscriptions"`
+	// Dedup merges the same servers across subscriptions, all are kept if nil
+	Dedup *Dedup `json:"dedup,omitempty"`
+}
+
+func (s *Subscription) String() string {
+	str := fmt.Sprintf(`Tag: %s
+URL: %s
+Ignore: %s
+Match: %s`,
+		s.Tag, s.URL, s.Ignore, s.Match)
+	if s.Outbound != "" {
+		str += "\nThrough outbound: " + s.Outbound
+	}
+	if s.Proxy != "" {
+		str += "\nThrough proxy: " + s.Proxy
+	}
+	return str
+}
+
+// Options are the options of Fetch and Watch
+type Options struct {
+	// SocketMark is the SO_MARK of generated outbounds, 0 for not set
+	SocketMark int32
+	// DryRun prints the diff of files that would be added, updated or
+	// removed, without changing any file
+	DryRun bool
+	// Prune removes the stale files in outdir, which are not generated
+	// by any of the subscriptions
+	Prune bool
+	// API applies the changes to a running v2ray if not nil, the file
+	// changes are rolled back if any outbound is rejected by the api.
+	// Stale files are kept without Prune, and so are their outbounds
+	API OutboundAPI
+	// Interval is the refresh interval of Watch, for subscriptions
+	// without an interval, defaults to 1 hour
+	Interval time.Duration
+}
+
+// Summary is the file changes of a run
+type Summary struct {
+	Added, Updated, Removed, Stale, Unchanged, Merged int
+	// Skipped is the count of links which can't be built as outbounds
+	Skipped int
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d removed, %d stale, %d unchanged, %d merged, %d skipped",
+		s.Added, s.Updated, s.Removed, s.Stale, s.Unchanged, s.Merged, s.Skipped)
+}
+
+// candidate is an outbound file to be written
+type candidate struct {
+	// name is the remarks of the link
+	name string
+	// sub is the tag of the subscription
+	sub string
+	// id is the identity of the link, see identity()
+	id       string
+	link     vmess.ProxyLink
+	out      *conf.OutboundDetourConfig
+	filename string
+	content  []byte
+}
+
+// result is the outbound files generated from a subscription
+type result struct {
+	cands   []*candidate
+	records []*latencyRecord
+	// skipped is the count of links which can't be built as outbounds
+	skipped int
+}
+
+// Fetch fetches subscription specified by "conf", and generating json files to "outdir"
+func Fetch(conf string, outdir string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.DryRun {
+		fmt.Println("Dry run, no file will be changed")
+	}
+	c, err := loadConfig(conf)
+	if err != nil {
+		return err
+	}
+	results := make([]*result, 0, len(c.Subscriptions))
+	for _, sub := range c.Subscriptions {
+		fmt.Println(sub)
+		fmt.Println("Output:", outdir)
+		r, _, err := fetchSubscription(sub, opts, nil)
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	summary, err := syncFiles(outdir, results, c.Dedup, opts, opts.Prune)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Summary:", summary)
+	return nil
+}
+
+func loadConfig(conf string) (*Config, error) {
+	c := &Config{}
+	data, err := ioutil.ReadFile(conf)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Dedup.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fetchSubscription downloads the subscription and converts the links to outbound
+// files. If cache is not nil, the download is conditional, and modified is false
+// if the subscription is not modified since last download, with a nil result
+func fetchSubscription(sub *Subscription, opts *Options, cache *bodyCache) (r *result, modified bool, err error) {
+	socketMark := opts.SocketMark
+	if socketMark != 0 {
+		fmt.Println("Sokect mark:", socketMark)
+	}
+	fmt.Println("Downloading...")
+	body, modified, err := download(sub, cache)
+	if err != nil {
+		return nil, false, err
+	}
+	if !modified {
+		fmt.Println("Not modified")
+		return nil, false, nil
+	}
+	links, err := vmess.LinksFromContent(body)
+	if err != nil {
+		return nil, false, err
+	}
+	fmt.Printf("%v link(s) found...\n", len(links))
+
+	links, err = filterLinks(links, sub.Ignore, sub.Match)
+	if err != nil {
+		return nil, false, err
+	}
+	r = &result{cands: make([]*candidate, 0, len(links))}
+	for _, link := range links {
+		out, err := link.ToOutbound(false)
+		if err != nil {
+			// e.g.: ss links with plugins which v2ray can't represent,
+			// like simple-obfs of clash proxies
+			fmt.Printf("Skipped: %s (%v)\n", link.Remarks(), err)
+			r.skipped++
+			continue
+		}
+		id, err := identity(link)
+		if err != nil {
+			return nil, false, err
+		}
+		// the tag and file name are finally decided by assignNames
+		out.Tag = asFileName(sub.Tag + " - " + link.Remarks())
+		content, err := outbound2JSON(out, socketMark)
+		if err != nil {
+			return nil, false, err
+		}
+		// e.g.: vless with an encryption which the core rejects, it would
+		// fail the api and roll back the whole sync if written
+		if _, err := buildOutbounds(content); err != nil {
+			fmt.Printf("Skipped: %s (%v)\n", link.Remarks(), err)
+			r.skipped++
+			continue
+		}
+		r.cands = append(r.cands, &candidate{
+			name:     link.Remarks(),
+			sub:      sub.Tag,
+			id:       id,
+			link:     link,
+			out:      out,
+			filename: out.Tag + ".json",
+			content:  content,
+		})
+	}
+	if r.skipped > 0 {
+		fmt.Printf("%d of %d link(s) skipped\n", r.skipped, len(links))
+	}
+	if sub.Probe != nil && len(r.cands) > 0 {
+		fmt.Printf("Probing %d link(s)...\n", len(r.cands))
+		r.cands, r.records, err = probe(sub.Probe, r.cands)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return r, true, nil
+}
+
+func asFileName(ps string) string {
+	reg := regexp.MustCompile(`([\\/:*?"<>|]|\s)+`)
+	r := reg.ReplaceAll([]byte(ps), []byte(" "))
+	return strings.TrimSpace(string(r))
+}
+
+// syncFiles writes the outbound files of results, deduplicated by d, to outdir,
+// and reports, or removes if prune, the stale files. The changes are applied to
+// opts.API if set
+func syncFiles(outdir string, results []*result, d *Dedup, opts *Options, prune bool) (*Summary, error) {
+	filesMap, err := getFilesMap(outdir)
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{}
+	var changes []*change
+	writeFile := func(filename string, data []byte) error {
+		if file, ok := filesMap[filename]; ok {
+			// file exist
+			rel, err := filepath.Rel(outdir, file)
+			if err != nil {
+				return err
+			}
+			hasher := md5.New()
+			s, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			hasher.Write(s)
+			fileMD5 := hex.EncodeToString(hasher.Sum(nil))
+			hasher.Reset()
+			hasher.Write(data)
+			dataMD5 := hex.EncodeToString(hasher.Sum(nil))
+			if fileMD5 != dataMD5 {
+				fmt.Println("Updated:", rel)
+				summary.Updated++
+				if opts.DryRun {
+					fmt.Print(unifiedDiff(rel, s, data))
+				} else {
+					err = ioutil.WriteFile(file, data, 0644)
+					if err != nil {
+						return err
+					}
+					changes = append(changes, &change{file: file, old: s, new: data})
+				}
+			} else {
+				summary.Unchanged++
+			}
+			delete(filesMap, filename)
+			return nil
+		}
+		// file not exist
+		file := filepath.Join(outdir, filename)
+		fmt.Println("Added:", filename)
+		summary.Added++
+		if opts.DryRun {
+			fmt.Print(unifiedDiff(filename, nil, data))
+			return nil
+		}
+		err := ioutil.WriteFile(file, data, 0644)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, &change{file: file, new: data})
+		return nil
+	}
+
+	for _, r := range results {
+		summary.Skipped += r.skipped
+	}
+	results, summary.Merged = dedup(results, d)
+	prev, err := readManifest(outdir)
+	if err != nil {
+		return nil, err
+	}
+	// the entries of files not written this time are kept until pruned,
+	// e.g.: nodes failed the probe, or subscriptions removed from config
+	keep := func(e *manifestEntry) bool {
+		_, ok := filesMap[e.File]
+		return ok && !prune
+	}
+	cands, manifest, err := assignNames(results, prev, keep, opts.SocketMark)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, c := range cands {
+		err = writeFile(c.filename, c.content)
+		if err != nil {
+			return nil, err
+		}
+		files[c.id] = c.filename
+	}
+	var latencies []*latencyRecord
+	for _, r := range results {
+		for _, rec := range r.records {
+			if f, ok := files[rec.ID]; ok {
+				rec.File = f
+			}
+		}
+		latencies = append(latencies, r.records...)
+	}
+	// the latency file is not an outbound file, but it's rolled back with them
+	var sidecars []*change
+	if latencies != nil && !opts.DryRun {
+		c, err := writeLatency(outdir, latencies)
+		if err != nil {
+			return nil, err
+		}
+		sidecars = append(sidecars, c)
+	}
+	stales := make([]string, 0, len(filesMap))
+	for _, file := range filesMap {
+		stales = append(stales, file)
+	}
+	sort.Strings(stales)
+	for _, file := range stales {
+		rel, err := filepath.Rel(outdir, file)
+		if err != nil {
+			return nil, err
+		}
+		if !prune {
+			fmt.Printf("Stale: %s (use -prune to remove)\n", rel)
+			summary.Stale++
+			continue
+		}
+		fmt.Println("Removed:", rel)
+		summary.Removed++
+		s, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if opts.DryRun {
+			fmt.Print(unifiedDiff(rel, s, nil))
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change{file: file, old: s})
+	}
+	if opts.API != nil && !opts.DryRun && len(changes) > 0 {
+		fmt.Println("Applying changes through api...")
+		if err := applyAPI(opts.API, changes); err != nil {
+			if rerr := rollbackFiles(append(changes, sidecars...)); rerr != nil {
+				return nil, fmt.Errorf("%v, and failed to roll back files: %v", err, rerr)
+			}
+			return nil, err
+		}
+	}
+	if !opts.DryRun {
+		if err := writeManifest(outdir, manifest); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+func getFilesMap(dir string) (map[string]string, error) {
+	files, err := files.GetFolderFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	filesMap := make(map[string]string)
+	for _, f := range files {
+		filesMap[filepath.Base(f)] = f
+	}
+	return filesMap, nil
+}
+
+// outbound2JSON converts vmess link to json string
+func outbound2JSON(out *conf.OutboundDetourConfig, socketMark int32) ([]byte, error) {
+	if socketMark != 0 {
+		if out.StreamSetting == nil {
+			out.StreamSetting = &conf.StreamConfig{}
+		}
+		out.StreamSetting.SocketSettings = &socketcfg.SocketConfig{
+			Mark: uint32(socketMark),
+		}
+	}
+	type outConfig struct {
+		OutboundConfigs []conf.OutboundDetourConfig `json:"outbounds"`
+	}
+	return json.Marshal(outConfig{
+		OutboundConfigs: []conf.OutboundDetourConfig{
+			*out,
+		},
+	})
+}
+
+func filterLinks(links []vmess.ProxyLink, exclude string, include string) ([]vmess.ProxyLink, error) {
+	lks := make([]vmess.ProxyLink, 0)
+	var (
+		err        error
+		regExclude *regexp.Regexp
+		regInclude *regexp.Regexp
+	)
+	if exclude != "" {
+		regExclude, err = regexp.Compile(exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if include != "" {
+		regInclude, err = regexp.Compile(include)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range links {
+		if regExclude != nil && regExclude.Match([]byte(l.Remarks())) {
+			fmt.Printf("Ignored: %s\n", l.Remarks())
+			continue
+		}
+		if regInclude != nil && !regInclude.Match([]byte(l.Remarks())) {
+			continue
+		}
+		lks = append(lks, l)
+	}
+	return lks, nil
+}
@@ -0,0 +1,127 @@
+package subscription
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("trojan://pass@example.com:443#a\ntrojan://pass@example.com:8443#b\n"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "subscriptions.conf")
+	outdir := filepath.Join(dir, "out")
+	c, _ := json.Marshal(&Config{Subscriptions: []*Subscription{{Tag: "sub", URL: srv.URL}}})
+	files := map[string]string{
+		conf:                                  string(c),
+		filepath.Join(outdir, "sub - a.json"): `{"outbounds":[]}`,
+		filepath.Join(outdir, "stale.json"):   `{"outbounds":[]}`,
+	}
+	os.MkdirAll(outdir, 0755)
+	for f, s := range files {
+		if err := ioutil.WriteFile(f, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func() []string {
+		fs, _ := filepath.Glob(filepath.Join(outdir, "*.json"))
+		for i, f := range fs {
+			fs[i] = filepath.Base(f)
+		}
+		return fs
+	}
+
+	if err := Fetch(conf, outdir, &Options{DryRun: true, Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]string{"stale.json", "sub - a.json"}, list()); d != "" {
+		t.Fatalf("dry run changed files: %s", d)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(outdir, "sub - a.json")); string(b) != `{"outbounds":[]}` {
+		t.Fatalf("dry run updated file: %s", b)
+	}
+
+	if err := Fetch(conf, outdir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]string{"stale.json", "sub - a.json", "sub - b.json"}, list()); d != "" {
+		t.Fatalf("stale file should be kept without prune: %s", d)
+	}
+
+	if err := Fetch(conf, outdir, &Options{Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]string{"sub - a.json", "sub - b.json"}, list()); d != "" {
+		t.Fatal(d)
+	}
+}
+
+func TestFetchSkipped(t *testing.T) {
+	// simple-obfs can't be built as an outbound, the node is skipped and counted
+	clash := `proxies:
+  - {name: a, type: trojan, server: example.com, port: 443, password: pass}
+  - {name: b, type: ss, server: example.com, port: 8388, cipher: aes-128-gcm, password: pass, plugin: obfs, plugin-opts: {mode: http, host: example.com}}
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(clash))
+	}))
+	defer srv.Close()
+
+	outdir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outdir)
+	opts := &Options{}
+	r, _, err := fetchSubscription(&Subscription{Tag: "sub", URL: srv.URL}, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := syncFiles(outdir, []*result{r}, nil, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(&Summary{Added: 1, Skipped: 1}, summary); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := []byte(`{"a":1,"b":2}`)
+	new := []byte(`{"a":1,"b":3}`)
+	tests := []struct {
+		name     string
+		old, new []byte
+		want     string
+	}{
+		{"updated", old, new, "--- a/x.json\n+++ b/x.json\n@@ -1,4 +1,4 @@\n {\n   \"a\": 1,\n-  \"b\": 2\n+  \"b\": 3\n }\n"},
+		{"added", nil, old, "--- /dev/null\n+++ b/x.json\n@@ -0,0 +1,4 @@\n+{\n+  \"a\": 1,\n+  \"b\": 2\n+}\n"},
+		{"removed", old, nil, "--- a/x.json\n+++ /dev/null\n@@ -1,4 +0,0 @@\n-{\n-  \"a\": 1,\n-  \"b\": 2\n-}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("x.json", tt.old, tt.new)
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+	if got := unifiedDiff("x.json", old, old); strings.TrimSpace(got) != "" {
+		t.Errorf("want no diff, got %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// defaultInterval is the refresh interval of Watch, if neither
+	// the subscription nor the options specifies one
+	defaultInterval = time.Hour
+	// minBackoff is the delay before retrying a failed subscription,
+	// which doubles on each failure, up to the interval
+	minBackoff = 30 * time.Second
+)
+
+// watchState is the state of a subscription kept between runs of Watch
+type watchState struct {
+	next     time.Time
+	failures int
+	cache    bodyCache
+	// result is the last successful result, nil if never succeeded
+	result *result
+}
+
+// Watch fetches each subscription of "conf" on its own interval, and syncs the
+// json files of "outdir" after any of them changes, until ctx is done.
+// Unchanged bodies are not downloaded again if the server supports ETag or
+// Last-Modified, and failed subscriptions are retried with backoff, keeping
+// their last outbounds. A failed sync is retried on the next wake, even if
+// nothing changes since.
+func Watch(ctx context.Context, conf string, outdir string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	c, err := loadConfig(conf)
+	if err != nil {
+		return err
+	}
+	subs := c.Subscriptions
+	if len(subs) == 0 {
+		return fmt.Errorf("no subscription in %s", conf)
+	}
+	states := make([]*watchState, len(subs))
+	for i := range states {
+		states[i] = &watchState{}
+	}
+	// dirty is set if the results are changed but not synced yet
+	dirty := false
+	for {
+		for i, sub := range subs {
+			st := states[i]
+			if time.Now().Before(st.next) {
+				continue
+			}
+			interval := opts.Interval
+			if sub.Interval > 0 {
+				interval = time.Duration(sub.Interval) * time.Second
+			}
+			if interval <= 0 {
+				interval = defaultInterval
+			}
+			log.Printf("fetching %s", sub.Tag)
+			// download conditionally only if the last body is converted
+			if st.result == nil {
+				st.cache = bodyCache{}
+			}
+			r, modified, err := fetchSubscription(sub, opts, &st.cache)
+			if err != nil {
+				st.failures++
+				delay := backoff(st.failures, interval)
+				st.next = time.Now().Add(delay)
+				log.Printf("failed to fetch %s: %v, retry in %v", sub.Tag, err, delay)
+				continue
+			}
+			st.failures = 0
+			st.next = time.Now().Add(interval)
+			if modified {
+				st.result = r
+				dirty = true
+			}
+		}
+		if dirty {
+			results := make([]*result, 0, len(subs))
+			prune := opts.Prune
+			for i, st := range states {
+				if st.result == nil {
+					// files of it could be taken as stale
+					if prune {
+						log.Printf("%s never fetched, pruning is skipped", subs[i].Tag)
+					}
+					prune = false
+					continue
+				}
+				results = append(results, st.result)
+			}
+			summary, err := syncFiles(outdir, results, c.Dedup, opts, prune)
+			if err != nil {
+				log.Printf("failed to sync files: %v, retry on next wake", err)
+			} else {
+				dirty = false
+				log.Printf("summary: %s", summary)
+			}
+		}
+
+		next := states[0].next
+		for _, st := range states[1:] {
+			if st.next.Before(next) {
+				next = st.next
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// backoff returns the delay before the next try after failures
+func backoff(failures int, interval time.Duration) time.Duration {
+	delay := minBackoff
+	for i := 1; i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	if delay > interval {
+		delay = interval
+	}
+	return delay
+}
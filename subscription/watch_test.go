@@ -0,0 +1,150 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qjebbs/v2tool/vmess"
+	"github.com/v2fly/v2ray-core/v5"
+)
+
+func TestWatch(t *testing.T) {
+	link := (&vmess.Link{Ver: "2", Add: "example.com", Port: "443", ID: "27b8a625-4f4b-4428-9f0f-8a2317db7c79", Aid: "0", Ps: "a", Net: "tcp", Type: "none"}).LinkStr("ng")
+	var (
+		mu          sync.Mutex
+		requests    int
+		notModified int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(link))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "subscriptions.conf")
+	outdir := filepath.Join(dir, "out")
+	os.MkdirAll(outdir, 0755)
+	c, _ := json.Marshal(&Config{Subscriptions: []*Subscription{
+		{Tag: "sub", URL: srv.URL, Interval: 1},
+		{Tag: "down", URL: srv.URL + "/down"},
+	}})
+	ioutil.WriteFile(conf, c, 0644)
+	// the file of "down", which should not be pruned since it's never fetched
+	ioutil.WriteFile(filepath.Join(outdir, "down - b.json"), []byte(`{}`), 0644)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	if err := Watch(ctx, conf, outdir, &Options{Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests < 3 || notModified != requests-1 {
+		t.Errorf("got %d requests, %d not modified", requests, notModified)
+	}
+	files, _ := filepath.Glob(filepath.Join(outdir, "*.json"))
+	for i, f := range files {
+		files[i] = filepath.Base(f)
+	}
+	if d := cmp.Diff([]string{"down - b.json", "sub - a.json"}, files); d != "" {
+		t.Error(d)
+	}
+}
+
+// flakyAPI rejects the first failures additions
+type flakyAPI struct {
+	fakeAPI
+	failures int
+}
+
+func (a *flakyAPI) AddOutbounds(obs []*core.OutboundHandlerConfig) error {
+	if a.failures > 0 {
+		a.failures--
+		return errors.New("rejected")
+	}
+	return a.fakeAPI.AddOutbounds(obs)
+}
+
+func TestWatchSyncRetry(t *testing.T) {
+	link := (&vmess.Link{Ver: "2", Add: "example.com", Port: "443", ID: "27b8a625-4f4b-4428-9f0f-8a2317db7c79", Aid: "0", Ps: "a", Net: "tcp", Type: "none"}).LinkStr("ng")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body never changes after the first sync fails
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(link))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "subscriptions.conf")
+	outdir := filepath.Join(dir, "out")
+	os.MkdirAll(outdir, 0755)
+	c, _ := json.Marshal(&Config{Subscriptions: []*Subscription{{Tag: "sub", URL: srv.URL, Interval: 1}}})
+	ioutil.WriteFile(conf, c, 0644)
+
+	a := &flakyAPI{fakeAPI: fakeAPI{running: map[string]bool{}}, failures: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if err := Watch(ctx, conf, outdir, &Options{API: a}); err != nil {
+		t.Fatal(err)
+	}
+	if a.failures != 0 || !a.running["sub - a"] {
+		t.Errorf("want the outbound applied after retry, got %v", a.running)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "sub - a.json")); err != nil {
+		t.Errorf("want the file written after retry: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		interval time.Duration
+		want     time.Duration
+	}{
+		{1, time.Hour, 30 * time.Second},
+		{2, time.Hour, time.Minute},
+		{4, time.Hour, 4 * time.Minute},
+		{100, time.Hour, time.Hour},
+		{1, 10 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.failures, tt.interval); got != tt.want {
+			t.Errorf("backoff(%d, %v) = %v, want %v", tt.failures, tt.interval, got, tt.want)
+		}
+	}
+}
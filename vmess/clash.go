@@ -0,0 +1,382 @@
+package vmess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// clashConfig is the part of clash config we care about
+type clashConfig struct {
+	Proxies []*clashProxy `yaml:"proxies"`
+}
+
+type clashProxy struct {
+	Name           string            `yaml:"name"`
+	Type           string            `yaml:"type"`
+	Server         string            `yaml:"server"`
+	Port           clashNumber       `yaml:"port"`
+	UUID           string            `yaml:"uuid,omitempty"`
+	AlterID        clashNumber       `yaml:"alterId,omitempty"`
+	Cipher         string            `yaml:"cipher,omitempty"`
+	Password       string            `yaml:"password,omitempty"`
+	TLS            bool              `yaml:"tls,omitempty"`
+	SkipCertVerify bool              `yaml:"skip-cert-verify,omitempty"`
+	ServerName     string            `yaml:"servername,omitempty"`
+	SNI            string            `yaml:"sni,omitempty"`
+	Network        string            `yaml:"network,omitempty"`
+	WSOpts         *clashWSOpts      `yaml:"ws-opts,omitempty"`
+	WSPath         string            `yaml:"ws-path,omitempty"`
+	WSHeaders      map[string]string `yaml:"ws-headers,omitempty"`
+	H2Opts         *clashH2Opts      `yaml:"h2-opts,omitempty"`
+	HTTPOpts       *clashHTTPOpts    `yaml:"http-opts,omitempty"`
+	GRPCOpts       *clashGRPCOpts    `yaml:"grpc-opts,omitempty"`
+	Plugin         string            `yaml:"plugin,omitempty"`
+	PluginOpts     map[string]string `yaml:"plugin-opts,omitempty"`
+}
+
+// clashNumber accepts both quoted and unquoted numbers, and is always written unquoted
+type clashNumber string
+
+func (p clashNumber) MarshalYAML() (interface{}, error) {
+	if n, err := strconv.Atoi(string(p)); err == nil {
+		return n, nil
+	}
+	return string(p), nil
+}
+
+type clashWSOpts struct {
+	Path    string            `yaml:"path,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+type clashH2Opts struct {
+	Host []string `yaml:"host,omitempty"`
+	Path string   `yaml:"path,omitempty"`
+}
+
+type clashGRPCOpts struct {
+	ServiceName string `yaml:"grpc-service-name,omitempty"`
+}
+
+type clashHTTPOpts struct {
+	Method  string              `yaml:"method,omitempty"`
+	Path    []string            `yaml:"path,omitempty"`
+	Headers map[string][]string `yaml:"headers,omitempty"`
+}
+
+// isClashConfig tells if content looks like a clash config
+func isClashConfig(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "proxies:") {
+			return true
+		}
+	}
+	return false
+}
+
+// LinksFromClash parses proxies in clash yaml config to links,
+// proxies of unsupported types are ignored
+func LinksFromClash(content []byte) ([]ProxyLink, error) {
+	c := &clashConfig{}
+	if err := yaml.Unmarshal(content, c); err != nil {
+		return nil, err
+	}
+	links := make([]ProxyLink, 0)
+	for _, p := range c.Proxies {
+		if p == nil {
+			continue
+		}
+		var (
+			lk  ProxyLink
+			err error
+		)
+		switch p.Type {
+		case "vmess":
+			lk, err = p.vmessLink()
+		case "ss":
+			lk, err = p.ssLink()
+		case "trojan":
+			lk, err = p.trojanLink()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("clash proxy %s: %v", p.Name, err)
+		}
+		links = append(links, lk)
+	}
+	return links, nil
+}
+
+func (p *clashProxy) port() (uint16, error) {
+	port, err := strconv.ParseUint(string(p.Port), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port: %s", p.Port)
+	}
+	return uint16(port), nil
+}
+
+func (p *clashProxy) wsPathHost() (string, string) {
+	path, headers := p.WSPath, p.WSHeaders
+	if p.WSOpts != nil {
+		if p.WSOpts.Path != "" {
+			path = p.WSOpts.Path
+		}
+		if len(p.WSOpts.Headers) > 0 {
+			headers = p.WSOpts.Headers
+		}
+	}
+	return path, headers["Host"]
+}
+
+func (p *clashProxy) vmessLink() (*Link, error) {
+	if _, err := p.port(); err != nil {
+		return nil, err
+	}
+	v := &Link{
+		Ver:  "2",
+		Add:  p.Server,
+		Port: string(p.Port),
+		ID:   p.UUID,
+		Aid:  string(p.AlterID),
+		Ps:   p.Name,
+		Net:  "tcp",
+		Type: "none",
+	}
+	if v.Aid == "" {
+		v.Aid = "0"
+	}
+	switch p.Network {
+	case "", "tcp":
+	case "http":
+		v.Type = "http"
+		if p.HTTPOpts != nil {
+			v.Path = strings.Join(p.HTTPOpts.Path, ",")
+			v.Host = strings.Join(p.HTTPOpts.Headers["Host"], ",")
+		}
+	case "ws":
+		v.Net = "ws"
+		v.Path, v.Host = p.wsPathHost()
+	case "h2":
+		v.Net = "h2"
+		if p.H2Opts != nil {
+			v.Path = p.H2Opts.Path
+			v.Host = strings.Join(p.H2Opts.Host, ",")
+		}
+	case "grpc":
+		v.Net = "grpc"
+		v.Type = "gun"
+		if p.GRPCOpts != nil {
+			v.Path = p.GRPCOpts.ServiceName
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", p.Network)
+	}
+	// cipher defaults to auto in clash
+	v.Scy = "auto"
+	if p.Cipher != "" {
+		v.Scy = p.Cipher
+	}
+	if p.TLS {
+		v.TLS = "tls"
+		if p.ServerName != strings.Split(v.Host, ",")[0] {
+			v.Sni = p.ServerName
+		}
+	}
+	return v, nil
+}
+
+func (p *clashProxy) ssLink() (*SSLink, error) {
+	port, err := p.port()
+	if err != nil {
+		return nil, err
+	}
+	v := &SSLink{
+		Method:   strings.ToLower(p.Cipher),
+		Password: p.Password,
+		Add:      p.Server,
+		Port:     port,
+		Ps:       p.Name,
+	}
+	switch p.Plugin {
+	case "":
+	case "obfs":
+		// kept for the share links, the outbound of simple-obfs can't be built
+		v.Plugin = "obfs-local"
+		v.PluginOpts = fmt.Sprintf("obfs=%s;obfs-host=%s", p.PluginOpts["mode"], p.PluginOpts["host"])
+	case "v2ray-plugin":
+		v.Plugin = "v2ray-plugin"
+		opts := []string{}
+		if p.PluginOpts["tls"] == "true" {
+			opts = append(opts, "tls")
+		}
+		for _, k := range []string{"host", "path"} {
+			if p.PluginOpts[k] != "" {
+				opts = append(opts, k+"="+p.PluginOpts[k])
+			}
+		}
+		v.PluginOpts = strings.Join(opts, ";")
+	default:
+		return nil, fmt.Errorf("unsupported plugin: %s", p.Plugin)
+	}
+	return v, nil
+}
+
+func (p *clashProxy) trojanLink() (*TrojanLink, error) {
+	port, err := p.port()
+	if err != nil {
+		return nil, err
+	}
+	v := &TrojanLink{
+		Password: p.Password,
+		Add:      p.Server,
+		Port:     port,
+		Net:      "tcp",
+		TLS:      "tls",
+		SNI:      p.SNI,
+		Ps:       p.Name,
+	}
+	switch p.Network {
+	case "", "tcp":
+	case "ws":
+		v.Net = "ws"
+		v.Path, v.Host = p.wsPathHost()
+	case "grpc":
+		v.Net = "grpc"
+		if p.GRPCOpts != nil {
+			v.ServiceName = p.GRPCOpts.ServiceName
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", p.Network)
+	}
+	return v, nil
+}
+
+// toClashProxy converts link to clash proxy entry
+func toClashProxy(lk ProxyLink) (*clashProxy, error) {
+	switch v := lk.(type) {
+	case *Link:
+		return v.asClashProxy()
+	case *SSLink:
+		p := &clashProxy{
+			Name:     v.Ps,
+			Type:     "ss",
+			Server:   v.Add,
+			Port:     clashNumber(strconv.Itoa(int(v.Port))),
+			Cipher:   v.Method,
+			Password: v.Password,
+		}
+		if v.Plugin != "" {
+			return nil, fmt.Errorf("ss plugin is not supported in clash output: %s", v.Plugin)
+		}
+		return p, nil
+	case *TrojanLink:
+		p := &clashProxy{
+			Name:     v.Ps,
+			Type:     "trojan",
+			Server:   v.Add,
+			Port:     clashNumber(strconv.Itoa(int(v.Port))),
+			Password: v.Password,
+			SNI:      v.SNI,
+		}
+		switch v.Net {
+		case "", "tcp":
+		case "ws":
+			p.Network = "ws"
+			p.WSOpts = &clashWSOpts{Path: v.Path}
+			if v.Host != "" {
+				p.WSOpts.Headers = map[string]string{"Host": v.Host}
+			}
+		case "grpc":
+			p.Network = "grpc"
+			p.GRPCOpts = &clashGRPCOpts{ServiceName: v.ServiceName}
+		default:
+			return nil, fmt.Errorf("network %s is not supported by clash", v.Net)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("%s is not supported by clash", lk.Protocol())
+}
+
+func (v Link) asClashProxy() (*clashProxy, error) {
+	p := &clashProxy{
+		Name:    v.Ps,
+		Type:    "vmess",
+		Server:  v.Add,
+		Port:    clashNumber(fmt.Sprintf("%v", v.Port)),
+		UUID:    v.ID,
+		AlterID: clashNumber(fmt.Sprintf("%v", v.Aid)),
+		Cipher:  v.security(),
+	}
+	if v.Aid == nil || p.AlterID == "" {
+		p.AlterID = "0"
+	}
+	switch v.Net {
+	case "", "tcp":
+		if v.Type == "http" {
+			p.Network = "http"
+			p.HTTPOpts = &clashHTTPOpts{Method: "GET"}
+			if v.Path != "" {
+				p.HTTPOpts.Path = strings.Split(v.Path, ",")
+			}
+			if v.Host != "" {
+				p.HTTPOpts.Headers = map[string][]string{"Host": strings.Split(v.Host, ",")}
+			}
+		}
+	case "ws":
+		p.Network = "ws"
+		p.WSOpts = &clashWSOpts{Path: v.Path}
+		if v.Host != "" {
+			p.WSOpts.Headers = map[string]string{"Host": v.Host}
+		}
+	case "h2", "http":
+		p.Network = "h2"
+		p.H2Opts = &clashH2Opts{Path: v.Path}
+		if v.Host != "" {
+			p.H2Opts.Host = strings.Split(v.Host, ",")
+		}
+	case "grpc":
+		p.Network = "grpc"
+		p.GRPCOpts = &clashGRPCOpts{ServiceName: v.Path}
+	default:
+		return nil, fmt.Errorf("network %s is not supported by clash", v.Net)
+	}
+	if v.TLS == "tls" {
+		p.TLS = true
+		p.SkipCertVerify = true
+		if v.Sni != "" {
+			p.ServerName = v.Sni
+		} else if v.Host != "" {
+			p.ServerName = strings.Split(v.Host, ",")[0]
+		}
+	}
+	return p, nil
+}
+
+func (v Link) asClash() string {
+	p, err := v.asClashProxy()
+	if err != nil {
+		return ""
+	}
+	b, err := yaml.Marshal([]*clashProxy{p})
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ClashProxies renders links as the "proxies" list of clash config
+func ClashProxies(links []ProxyLink) ([]byte, error) {
+	c := &clashConfig{}
+	for _, lk := range links {
+		p, err := toClashProxy(lk)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", lk.Remarks(), err)
+		}
+		c.Proxies = append(c.Proxies, p)
+	}
+	return yaml.Marshal(c)
+}
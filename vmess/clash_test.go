@@ -0,0 +1,119 @@
+package vmess
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const clashYAML = `
+port: 7890
+proxies:
+  - name: "ws tls"
+    type: vmess
+    server: example.com
+    port: 443
+    uuid: 2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e
+    alterId: 2
+    cipher: auto
+    tls: true
+    servername: sni.example.com
+    network: ws
+    ws-opts:
+      path: /ws
+  - name: legacy ws
+    type: vmess
+    server: example.com
+    port: "8080"
+    uuid: 2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e
+    network: ws
+    ws-path: /legacy
+    ws-headers:
+      Host: cdn.example.com
+  - name: h2
+    type: vmess
+    server: example.com
+    port: 443
+    uuid: 2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e
+    network: h2
+    tls: true
+    h2-opts:
+      host: [h2.example.com]
+      path: /h2
+  - name: ss
+    type: ss
+    server: example.com
+    port: 8388
+    cipher: aes-256-gcm
+    password: pass
+  - name: trojan ws
+    type: trojan
+    server: example.com
+    port: 443
+    password: pass
+    sni: sni.example.com
+    network: ws
+    ws-opts:
+      path: /ws
+      headers:
+        Host: cdn.example.com
+  - name: trojan grpc
+    type: trojan
+    server: example.com
+    port: 443
+    password: pass
+    sni: sni.example.com
+    network: grpc
+    grpc-opts:
+      grpc-service-name: svc
+  - name: snell
+    type: snell
+    server: example.com
+    port: 443
+`
+
+func TestLinksFromClash(t *testing.T) {
+	want := []ProxyLink{
+		&Link{Ver: "2", Add: "example.com", Port: "443", ID: "2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e", Aid: "2", Ps: "ws tls", Net: "ws", Type: "none", Path: "/ws", TLS: "tls", Scy: "auto", Sni: "sni.example.com"},
+		&Link{Ver: "2", Add: "example.com", Port: "8080", ID: "2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e", Aid: "0", Ps: "legacy ws", Net: "ws", Type: "none", Path: "/legacy", Host: "cdn.example.com", Scy: "auto"},
+		&Link{Ver: "2", Add: "example.com", Port: "443", ID: "2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e", Aid: "0", Ps: "h2", Net: "h2", Type: "none", Path: "/h2", TLS: "tls", Host: "h2.example.com", Scy: "auto"},
+		&SSLink{Method: "aes-256-gcm", Password: "pass", Add: "example.com", Port: 8388, Ps: "ss"},
+		&TrojanLink{Password: "pass", Add: "example.com", Port: 443, Net: "ws", TLS: "tls", Host: "cdn.example.com", Path: "/ws", SNI: "sni.example.com", Ps: "trojan ws"},
+		&TrojanLink{Password: "pass", Add: "example.com", Port: 443, Net: "grpc", TLS: "tls", SNI: "sni.example.com", ServiceName: "svc", Ps: "trojan grpc"},
+	}
+	if !isClashConfig([]byte(clashYAML)) {
+		t.Fatal("clash config not detected")
+	}
+	got, err := LinksFromContent([]byte(clashYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Fatal(d)
+	}
+
+	// round trip
+	b, err := ClashProxies(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LinksFromClash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(got, again); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestClashProxiesUnsupported(t *testing.T) {
+	links := []ProxyLink{
+		&TrojanLink{Password: "pass", Add: "example.com", Port: 443, Net: "h2", TLS: "tls", Ps: "trojan h2"},
+		&Link{Add: "example.com", Port: 443, ID: "2a0e6a3c-0f7b-4d6f-9c4e-1f3b2b7c8d9e", Net: "kcp", Ps: "kcp"},
+	}
+	for _, lk := range links {
+		if _, err := ClashProxies([]ProxyLink{lk}); err == nil {
+			t.Errorf("%s: want error", lk.Remarks())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package vmess
+
+import (
+	"testing"
+)
+
+// seed corpus of the fuzz targets are in testdata/fuzz
+
+// exercise calls the methods of a parsed link, which should never panic
+func exercise(t *testing.T, lk ProxyLink) {
+	_ = lk.String()
+	_ = lk.DetailStr()
+	_ = lk.ShareLink()
+	_, _ = lk.ToOutbound(false)
+	if v, ok := lk.(*Link); ok {
+		for _, f := range []string{"ng", "rk", "quan", "quanx", "surge", "clash"} {
+			_ = v.LinkStr(f)
+			_ = v.LossyFields(f)
+		}
+		_ = v.Validate()
+	}
+}
+
+func fuzzParser(f *testing.F, parse func(string) (*Link, error)) {
+	f.Fuzz(func(t *testing.T, s string) {
+		lk, err := parse(s)
+		if err != nil {
+			return
+		}
+		if lk == nil {
+			t.Fatal("nil link without error")
+		}
+		exercise(t, lk)
+	})
+}
+
+func FuzzNewVnVmess(f *testing.F) {
+	fuzzParser(f, NewVnVmess)
+}
+
+func FuzzNewRkVmess(f *testing.F) {
+	fuzzParser(f, NewRkVmess)
+}
+
+func FuzzNewQuanVmess(f *testing.F) {
+	fuzzParser(f, NewQuanVmess)
+}
+
+func FuzzParseVmess(f *testing.F) {
+	fuzzParser(f, ParseVmess)
+}
+
+func FuzzLinksFromContent(f *testing.F) {
+	f.Fuzz(func(t *testing.T, b []byte) {
+		links, err := LinksFromContent(b)
+		if err != nil {
+			return
+		}
+		for _, lk := range links {
+			exercise(t, lk)
+		}
+	})
+}
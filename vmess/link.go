@@ -0,0 +1,71 @@
+package vmess
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon/muxcfg"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// ProxyLink is a parsed share link of any supported protocol
+type ProxyLink interface {
+	fmt.Stringer
+	// Protocol returns the protocol of the link, e.g. "vmess"
+	Protocol() string
+	// Remarks returns the remarks (name) of the link
+	Remarks() string
+	// Server returns the address and port of the server
+	Server() (string, string)
+	// DetailStr returns human readable detail of the link
+	DetailStr() string
+	// ShareLink returns the original link string if any,
+	// or the link in its default format
+	ShareLink() string
+	// ToOutbound converts the link to *OutboundDetourConfig
+	ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error)
+}
+
+var linkParsers = map[string]func(string) (ProxyLink, error){
+	"vmess://":  func(s string) (ProxyLink, error) { return ParseVmess(s) },
+	"vless://":  func(s string) (ProxyLink, error) { return ParseVless(s) },
+	"ss://":     func(s string) (ProxyLink, error) { return ParseShadowsocks(s) },
+	"trojan://": func(s string) (ProxyLink, error) { return ParseTrojan(s) },
+}
+
+// IsSupportedLink tells if s is a share link of supported protocols,
+// or a vmess proxy line of quantumult x and surge
+func IsSupportedLink(s string) bool {
+	for prefix := range linkParsers {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return isQuanXLine(s) || isSurgeLine(s)
+}
+
+// ParseLink parses a share link of any supported protocol
+func ParseLink(s string) (ProxyLink, error) {
+	s = strings.TrimSpace(s)
+	for prefix, parse := range linkParsers {
+		if strings.HasPrefix(s, prefix) {
+			return parse(s)
+		}
+	}
+	if isQuanXLine(s) {
+		return NewQuanXVmess(s)
+	}
+	if isSurgeLine(s) {
+		return NewSurgeVmess(s)
+	}
+	return nil, fmt.Errorf("link unreconized: %s", s)
+}
+
+func muxConfig(usemux bool) *muxcfg.MuxConfig {
+	mux := &muxcfg.MuxConfig{}
+	if usemux {
+		mux.Enabled = true
+		mux.Concurrency = 8
+	}
+	return mux
+}
@@ -3,35 +3,90 @@ package vmess
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
-	"v2ray.com/core/infra/conf"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon/tlscfg"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
 )
 
 // Link2Outbound converts vmess link to *OutboundDetourConfig
 func Link2Outbound(v *Link, usemux bool) (*conf.OutboundDetourConfig, error) {
 	out := &conf.OutboundDetourConfig{}
 	out.Protocol = "vmess"
-	out.MuxSettings = &conf.MuxConfig{}
-	if usemux {
-		out.MuxSettings.Enabled = true
-		out.MuxSettings.Concurrency = 8
+	out.MuxSettings = muxConfig(usemux)
+
+	t := &transportInfo{
+		Net:  v.Net,
+		Type: v.Type,
+		Host: v.Host,
+		Path: v.Path,
+		TLS:  v.TLS,
+		SNI:  v.Sni,
+		ALPN: v.Alpn,
+	}
+	if v.Net == "grpc" {
+		// v2rayN puts grpc serviceName in path, and mode in type
+		t.ServiceName = v.Path
+	}
+	s, err := streamConfig(t)
+	if err != nil {
+		return nil, err
 	}
 
-	p := conf.TransportProtocol(v.Net)
+	out.StreamSetting = s
+	oset := json.RawMessage([]byte(fmt.Sprintf(`{
+  "vnext": [
+    {
+      "address": "%s",
+      "port": %v,
+      "users": [
+        {
+          "id": "%s",
+          "alterId": %v,
+          "security": "%s"
+        }
+      ]
+    }
+  ]
+}`, v.Add, v.Port, v.ID, v.Aid, v.security())))
+	out.Settings = &oset
+	return out, nil
+}
+
+// transportInfo is the transport part of a share link
+type transportInfo struct {
+	Net  string
+	Type string
+	Host string
+	Path string
+	TLS  string
+	// SNI is the tls server name, falls back to Host if empty
+	SNI string
+	// ALPN is the comma separated tls alpn
+	ALPN string
+	// ServiceName is the grpc service name
+	ServiceName string
+}
+
+// streamConfig builds the stream settings of a share link.
+// For quic, Host is the quic security, Path is the key, and Type is the header type
+func streamConfig(t *transportInfo) (*conf.StreamConfig, error) {
+	p := conf.TransportProtocol(t.Net)
 	s := &conf.StreamConfig{
 		Network:  &p,
-		Security: v.TLS,
+		Security: t.TLS,
 	}
 
-	switch v.Net {
+	switch t.Net {
 	case "tcp":
 		s.TCPSettings = &conf.TCPConfig{}
-		if v.Type == "" || v.Type == "none" {
+		if t.Type == "" || t.Type == "none" {
 			s.TCPSettings.HeaderConfig = json.RawMessage([]byte(`{ "type": "none" }`))
 		} else {
-			pathb, _ := json.Marshal(strings.Split(v.Path, ","))
-			hostb, _ := json.Marshal(strings.Split(v.Host, ","))
+			pathb, _ := json.Marshal(strings.Split(t.Path, ","))
+			hostb, _ := json.Marshal(strings.Split(t.Host, ","))
 			s.TCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`
 			{
 				"type": "http",
@@ -46,48 +101,241 @@ func Link2Outbound(v *Link, usemux bool) (*conf.OutboundDetourConfig, error) {
 		}
 	case "kcp":
 		s.KCPSettings = &conf.KCPConfig{}
-		s.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, v.Type)))
+		s.KCPSettings.HeaderConfig = json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, t.Type)))
 	case "ws":
 		s.WSSettings = &conf.WebSocketConfig{}
-		s.WSSettings.Path = v.Path
+		s.WSSettings.Path = t.Path
 		s.WSSettings.Headers = map[string]string{
-			"Host": v.Host,
+			"Host": t.Host,
 		}
 	case "h2", "http":
 		s.HTTPSettings = &conf.HTTPConfig{
-			Path: v.Path,
+			Path: t.Path,
 		}
-		if v.Host != "" {
-			h := conf.StringList(strings.Split(v.Host, ","))
+		if t.Host != "" {
+			h := cfgcommon.StringList(strings.Split(t.Host, ","))
 			s.HTTPSettings.Host = &h
 		}
+	case "quic":
+		header := t.Type
+		if header == "" {
+			header = "none"
+		}
+		security := t.Host
+		if security == "" {
+			security = "none"
+		}
+		s.QUICSettings = &conf.QUICConfig{
+			Header:   json.RawMessage([]byte(fmt.Sprintf(`{ "type": "%s" }`, header))),
+			Security: security,
+			Key:      t.Path,
+		}
+	case "grpc":
+		// the core dials in gun mode only, which multi mode servers serve too
+		s.GRPCSettings = &conf.GunConfig{ServiceName: t.ServiceName}
 	}
 
-	if v.TLS == "tls" {
-		s.TLSSettings = &conf.TLSConfig{
+	if t.TLS == "tls" {
+		s.TLSSettings = &tlscfg.TLSConfig{
 			Insecure: true,
 		}
-		if v.Host != "" {
-			s.TLSSettings.ServerName = v.Host
+		if t.SNI != "" {
+			s.TLSSettings.ServerName = t.SNI
+		} else if t.Host != "" && t.Net != "quic" {
+			s.TLSSettings.ServerName = t.Host
+		}
+		if t.ALPN != "" {
+			alpn := cfgcommon.StringList(strings.Split(t.ALPN, ","))
+			s.TLSSettings.ALPN = &alpn
 		}
 	}
+	return s, nil
+}
 
-	out.StreamSetting = s
-	oset := json.RawMessage([]byte(fmt.Sprintf(`{
-  "vnext": [
-    {
-      "address": "%s",
-      "port": %v,
-      "users": [
-        {
-          "id": "%s",
-          "alterId": %v,
-          "security": "auto"
-        }
-      ]
-    }
-  ]
-}`, v.Add, v.Port, v.ID, v.Aid)))
-	out.Settings = &oset
-	return out, nil
+// Outbound2Link converts vmess *OutboundDetourConfig to vmess link,
+// it fails if there are settings the link cannot represent
+func Outbound2Link(out *conf.OutboundDetourConfig) (*Link, error) {
+	if out.Protocol != "vmess" {
+		return nil, fmt.Errorf("not a vmess outbound: %s", out.Protocol)
+	}
+	if out.Settings == nil {
+		return nil, fmt.Errorf("vmess outbound has no settings")
+	}
+	type user struct {
+		ID       string      `json:"id"`
+		AlterID  json.Number `json:"alterId"`
+		Security string      `json:"security"`
+	}
+	type server struct {
+		Address string      `json:"address"`
+		Port    json.Number `json:"port"`
+		Users   []*user     `json:"users"`
+	}
+	settings := &struct {
+		Vnext []*server `json:"vnext"`
+	}{}
+	if err := json.Unmarshal(*out.Settings, settings); err != nil {
+		return nil, fmt.Errorf("invalid vmess settings: %v", err)
+	}
+	if len(settings.Vnext) == 0 || settings.Vnext[0] == nil || len(settings.Vnext[0].Users) == 0 || settings.Vnext[0].Users[0] == nil {
+		return nil, fmt.Errorf("no server or user in vmess settings")
+	}
+
+	// collect all the problems, rather than the first one
+	problems := make([]string, 0)
+	if len(settings.Vnext) > 1 {
+		problems = append(problems, fmt.Sprintf("%d servers in vnext, a link has only one", len(settings.Vnext)))
+	}
+	srv := settings.Vnext[0]
+	if len(srv.Users) > 1 {
+		problems = append(problems, fmt.Sprintf("%d users of server, a link has only one", len(srv.Users)))
+	}
+	u := srv.Users[0]
+	if out.ProxySettings != nil {
+		problems = append(problems, "proxySettings")
+	}
+
+	aid := u.AlterID.String()
+	if aid == "" {
+		aid = "0"
+	}
+	link := &Link{
+		Ver:  "2",
+		Add:  srv.Address,
+		Port: srv.Port.String(),
+		ID:   u.ID,
+		Aid:  aid,
+		Scy:  u.Security,
+		Ps:   out.Tag,
+		Net:  "tcp",
+		Type: "none",
+	}
+	problems = append(problems, streamToLink(out.StreamSetting, link)...)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("vmess link cannot represent: %s", strings.Join(problems, "; "))
+	}
+	return link, nil
+}
+
+// streamToLink fills the transport fields of link from stream settings,
+// and returns the settings that can not be represented
+func streamToLink(s *conf.StreamConfig, link *Link) []string {
+	if s == nil {
+		return nil
+	}
+	problems := make([]string, 0)
+	if s.Network != nil {
+		link.Net = strings.ToLower(string(*s.Network))
+	}
+	header := func(raw json.RawMessage) string {
+		h := &struct {
+			Type string `json:"type"`
+		}{}
+		if len(raw) > 0 {
+			json.Unmarshal(raw, h)
+		}
+		if h.Type == "" {
+			return "none"
+		}
+		return h.Type
+	}
+	switch link.Net {
+	case "", "tcp":
+		link.Net = "tcp"
+		if s.TCPSettings == nil || header(s.TCPSettings.HeaderConfig) == "none" {
+			break
+		}
+		h := &struct {
+			Type    string `json:"type"`
+			Request struct {
+				Path    []string            `json:"path"`
+				Headers map[string][]string `json:"headers"`
+			} `json:"request"`
+		}{}
+		if err := json.Unmarshal(s.TCPSettings.HeaderConfig, h); err != nil {
+			problems = append(problems, fmt.Sprintf("tcp header: %v", err))
+			break
+		}
+		if h.Type != "http" {
+			problems = append(problems, fmt.Sprintf("tcp header type %q", h.Type))
+			break
+		}
+		link.Type = "http"
+		link.Path = strings.Join(h.Request.Path, ",")
+		for k, v := range h.Request.Headers {
+			if k == "Host" {
+				link.Host = strings.Join(v, ",")
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("tcp http header %q", k))
+		}
+	case "kcp", "mkcp":
+		link.Net = "kcp"
+		if s.KCPSettings != nil {
+			link.Type = header(s.KCPSettings.HeaderConfig)
+		}
+	case "ws", "websocket":
+		link.Net = "ws"
+		if s.WSSettings != nil {
+			link.Path = s.WSSettings.Path
+			for k, v := range s.WSSettings.Headers {
+				if k == "Host" {
+					link.Host = v
+					continue
+				}
+				if v == "" {
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("ws header %q", k))
+			}
+		}
+	case "h2", "http":
+		link.Net = "h2"
+		if s.HTTPSettings != nil {
+			link.Path = s.HTTPSettings.Path
+			if s.HTTPSettings.Host != nil {
+				link.Host = strings.Join(*s.HTTPSettings.Host, ",")
+			}
+		}
+	case "quic":
+		// v2rayN puts quic security in host, and key in path
+		if s.QUICSettings != nil {
+			link.Type = header(s.QUICSettings.Header)
+			link.Host = s.QUICSettings.Security
+			link.Path = s.QUICSettings.Key
+		}
+	case "grpc", "gun":
+		// v2rayN puts grpc serviceName in path, and mode in type
+		link.Net, link.Type = "grpc", "gun"
+		g := s.GunSettings
+		if g == nil {
+			g = s.GRPCSettings
+		}
+		if g != nil {
+			link.Path = g.ServiceName
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("network %q", link.Net))
+	}
+
+	switch s.Security {
+	case "", "none":
+	case "tls":
+		link.TLS = "tls"
+		if t := s.TLSSettings; t != nil {
+			if t.ServerName != "" && t.ServerName != strings.Split(link.Host, ",")[0] {
+				link.Sni = t.ServerName
+			}
+			if t.ALPN != nil && len(*t.ALPN) > 0 {
+				link.Alpn = strings.Join(*t.ALPN, ",")
+			}
+			if len(t.Certs) > 0 {
+				problems = append(problems, "tls certificates")
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("security %q", s.Security))
+	}
+	return problems
 }
@@ -0,0 +1,154 @@
+package vmess
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/v2fly/v2ray-core/v5/app/proxyman"
+	"github.com/v2fly/v2ray-core/v5/common/protocol"
+	"github.com/v2fly/v2ray-core/v5/common/serial"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+	"github.com/v2fly/v2ray-core/v5/transport/internet"
+	"github.com/v2fly/v2ray-core/v5/transport/internet/grpc"
+	"github.com/v2fly/v2ray-core/v5/transport/internet/quic"
+	"github.com/v2fly/v2ray-core/v5/transport/internet/tls"
+)
+
+func TestOutbound2Link(t *testing.T) {
+	tests := []struct {
+		name string
+		link *Link
+	}{
+		{"tcp", &Link{Net: "tcp", Type: "none"}},
+		{"tcp http", &Link{Net: "tcp", Type: "http", Host: "a.example.com,b.example.com", Path: "/a,/b"}},
+		{"kcp", &Link{Net: "kcp", Type: "wechat-video"}},
+		{"ws tls", &Link{Net: "ws", Type: "none", Host: "cdn.example.com", Path: "/ws", TLS: "tls"}},
+		{"h2 tls", &Link{Net: "h2", Type: "none", Host: "h2.example.com", Path: "/h2", TLS: "tls"}},
+		{"quic", &Link{Net: "quic", Type: "srtp", Host: "aes-128-gcm", Path: "quic-key"}},
+		{"tcp tls", &Link{Net: "tcp", Type: "none", TLS: "tls", Sni: "sni.example.com", Alpn: "h2,http/1.1", Scy: "chacha20-poly1305"}},
+		{"grpc tls", &Link{Net: "grpc", Type: "gun", Path: "svc", TLS: "tls", Sni: "sni.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.link
+			want.Ver, want.Add, want.Port, want.ID, want.Aid, want.Ps = "2", "example.com", "443", "27b8a625-4f4b-4428-9f0f-8a2317db7c79", "4", tt.name
+			if want.Scy == "" {
+				want.Scy = "auto"
+			}
+			out, err := Link2Outbound(want, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Tag = tt.name
+			got, err := Outbound2Link(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(want, got); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestOutbound2LinkUnrepresentable(t *testing.T) {
+	out := &conf.OutboundDetourConfig{}
+	err := json.Unmarshal([]byte(`{
+		"protocol": "vmess",
+		"settings": {"vnext": [{"address": "example.com", "port": 443, "users": [{"id": "x"}, {"id": "y"}]}]},
+		"streamSettings": {"network": "ws", "security": "tls", "wsSettings": {"headers": {"User-Agent": "curl"}}, "tlsSettings": {"certificates": [{}]}}
+	}`), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Outbound2Link(out)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, s := range []string{"2 users", `ws header "User-Agent"`, "tls certificates"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q should mention %s", err, s)
+		}
+	}
+}
+
+func TestLink2OutboundBuild(t *testing.T) {
+	link := func(l *Link) *Link {
+		l.Add, l.Port, l.ID, l.Aid = "example.com", "443", "27b8a625-4f4b-4428-9f0f-8a2317db7c79", "0"
+		return l
+	}
+	build := func(t *testing.T, l *Link) *internet.StreamConfig {
+		out, err := Link2Outbound(l, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ob, err := out.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender, err := serial.GetInstanceOf(ob.SenderSettings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sender.(*proxyman.SenderConfig).StreamSettings
+	}
+
+	t.Run("quic", func(t *testing.T) {
+		ss := build(t, link(&Link{Net: "quic", Type: "wechat-video", Host: "chacha20-poly1305", Path: "quic-key"}))
+		if ss.ProtocolName != "quic" {
+			t.Fatalf("protocol %s", ss.ProtocolName)
+		}
+		inst, err := serial.GetInstanceOf(ss.TransportSettings[0].Settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qc := inst.(*quic.Config)
+		if qc.Key != "quic-key" || qc.Security.Type != protocol.SecurityType_CHACHA20_POLY1305 {
+			t.Errorf("got key %q, security %v", qc.Key, qc.Security.Type)
+		}
+		if h := serial.V2Type(qc.Header); h != "v2ray.core.transport.internet.headers.wechat.VideoConfig" {
+			t.Errorf("got header %s", h)
+		}
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		ss := build(t, link(&Link{Net: "ws", Host: "cdn.example.com", TLS: "tls", Sni: "sni.example.com", Alpn: "h2,http/1.1"}))
+		inst, err := serial.GetInstanceOf(ss.SecuritySettings[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc := inst.(*tls.Config)
+		if tc.ServerName != "sni.example.com" {
+			t.Errorf("got server name %s", tc.ServerName)
+		}
+		if d := cmp.Diff([]string{"h2", "http/1.1"}, tc.NextProtocol); d != "" {
+			t.Error(d)
+		}
+	})
+
+	for mode, lost := range map[string]string{"gun": "", "multi": "type=multi"} {
+		t.Run("grpc "+mode, func(t *testing.T) {
+			l := &Link{Net: "grpc", Type: mode, Path: "svc", TLS: "tls", Sni: "sni.example.com"}
+			// multi mode is built as gun, which multi mode servers serve too
+			if got := strings.Join(l.LossyFields("json"), ", "); got != lost {
+				t.Errorf("got lossy fields %q, want %q", got, lost)
+			}
+			ss := build(t, link(l))
+			if ss.ProtocolName != "gun" {
+				t.Fatalf("protocol %s", ss.ProtocolName)
+			}
+			inst, err := serial.GetInstanceOf(ss.TransportSettings[0].Settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gc := inst.(*grpc.Config); gc.ServiceName != "svc" {
+				t.Errorf("got service name %s", gc.ServiceName)
+			}
+			if len(ss.SecuritySettings) != 1 {
+				t.Errorf("got %d security settings", len(ss.SecuritySettings))
+			}
+		})
+	}
+}
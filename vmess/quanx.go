@@ -0,0 +1,116 @@
+package vmess
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// quanXMethod is the method written to quantumult x lines,
+// if the link security is not supported by quantumult x
+const quanXMethod = "aes-128-gcm"
+
+// isQuanXLine tells if s is a quantumult x vmess line, in the format of
+// vmess=example.com:443, method=aes-128-gcm, password=uuid, obfs=wss, tag=name
+func isQuanXLine(s string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "vmess=")
+}
+
+// NewQuanXVmess parses Quantumult X vmess line to VmessLink
+func NewQuanXVmess(line string) (*Link, error) {
+	line = strings.TrimSpace(line)
+	if !isQuanXLine(line) {
+		return nil, fmt.Errorf("quantumult x vmess unreconized: %s", line)
+	}
+	params := strings.Split(line[6:], ",")
+	host, port, err := net.SplitHostPort(strings.TrimSpace(params[0]))
+	if err != nil {
+		return nil, fmt.Errorf("quantumult x vmess unreconized: host:port -- %v", err)
+	}
+	v := &Link{
+		Ver:      "2",
+		Add:      host,
+		Port:     port,
+		Aid:      "0",
+		Net:      "tcp",
+		Type:     "none",
+		OrigLink: line,
+	}
+	for _, pkv := range params[1:] {
+		kvp := strings.SplitN(strings.TrimSpace(pkv), "=", 2)
+		if len(kvp) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(kvp[1])
+		switch strings.TrimSpace(kvp[0]) {
+		case "method":
+			v.Scy = quanScy(val)
+		case "password":
+			v.ID = val
+		case "obfs":
+			switch val {
+			case "ws":
+				v.Net = "ws"
+			case "wss":
+				v.Net = "ws"
+				v.TLS = "tls"
+			case "over-tls":
+				v.TLS = "tls"
+			case "http":
+				v.Type = "http"
+			}
+		case "obfs-host":
+			v.Host = val
+		case "obfs-uri":
+			v.Path = val
+		case "tls-host":
+			v.Sni = val
+		case "tag":
+			v.Ps = val
+		}
+	}
+	if v.ID == "" {
+		return nil, fmt.Errorf("quantumult x vmess unreconized: no password -- %s", line)
+	}
+	return v, nil
+}
+
+func (v Link) asQuantumultX() string {
+	method, ok := quanMethods[v.Scy]
+	if !ok {
+		method = quanXMethod
+	}
+	parts := []string{
+		fmt.Sprintf("vmess=%s", net.JoinHostPort(v.Add, fmt.Sprintf("%v", v.Port))),
+		"method=" + method,
+		"password=" + v.ID,
+	}
+	obfs := ""
+	switch {
+	case v.Net == "ws" && v.TLS == "tls":
+		obfs = "wss"
+	case v.Net == "ws":
+		obfs = "ws"
+	case v.Type == "http":
+		obfs = "http"
+	case v.TLS == "tls":
+		obfs = "over-tls"
+	}
+	if obfs != "" {
+		parts = append(parts, "obfs="+obfs)
+	}
+	if v.Host != "" {
+		parts = append(parts, "obfs-host="+v.Host)
+	}
+	if v.Path != "" {
+		parts = append(parts, "obfs-uri="+v.Path)
+	}
+	if v.TLS == "tls" {
+		if v.Sni != "" {
+			parts = append(parts, "tls-host="+v.Sni)
+		}
+		parts = append(parts, "tls-verification=false")
+	}
+	parts = append(parts, "tag="+v.Ps)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,277 @@
+package vmess
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// SSLink represents a parsed shadowsocks link, in SIP002 format
+// ss://base64(method:password)@host:port/?plugin=...#remarks,
+// or the legacy format ss://base64(method:password@host:port)#remarks
+type SSLink struct {
+	Method   string
+	Password string
+	Add      string
+	Port     uint16
+	// Plugin is the plugin name, e.g. "v2ray-plugin"
+	Plugin string
+	// PluginOpts is the plugin options, e.g. "tls;host=example.com"
+	PluginOpts string
+	Ps         string
+	OrigLink   string
+}
+
+// ParseShadowsocks parses shadowsocks link in SIP002 or legacy format
+func ParseShadowsocks(ss string) (*SSLink, error) {
+	if !strings.HasPrefix(ss, "ss://") {
+		return nil, fmt.Errorf("ss unreconized: %s", ss)
+	}
+	link := &SSLink{OrigLink: ss}
+	body := ss[5:]
+	if i := strings.Index(body, "#"); i >= 0 {
+		ps, err := url.PathUnescape(body[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		link.Ps = ps
+		body = body[:i]
+	}
+	query := ""
+	if i := strings.Index(body, "?"); i >= 0 {
+		query = body[i+1:]
+		body = body[:i]
+	}
+	body = strings.TrimSuffix(body, "/")
+
+	var userinfo, hostport string
+	if i := strings.LastIndex(body, "@"); i >= 0 {
+		// SIP002, userinfo could be base64 encoded or plain
+		userinfo, hostport = body[:i], body[i+1:]
+		if u, err := url.PathUnescape(userinfo); err == nil {
+			userinfo = u
+		}
+		if !strings.Contains(userinfo, ":") {
+			b, err := base64Decode(userinfo)
+			if err != nil {
+				return nil, fmt.Errorf("ss unreconized: userinfo -- %v", err)
+			}
+			userinfo = string(b)
+		}
+	} else {
+		b, err := base64Decode(body)
+		if err != nil {
+			return nil, fmt.Errorf("ss unreconized: %v", err)
+		}
+		decoded := string(b)
+		i := strings.LastIndex(decoded, "@")
+		if i < 0 {
+			return nil, fmt.Errorf("ss unreconized: method:password@host:port -- %s", decoded)
+		}
+		userinfo, hostport = decoded[:i], decoded[i+1:]
+	}
+
+	mp := strings.SplitN(userinfo, ":", 2)
+	if len(mp) != 2 || mp[0] == "" {
+		return nil, fmt.Errorf("ss unreconized: method:password -- %s", userinfo)
+	}
+	link.Method, link.Password = strings.ToLower(mp[0]), mp[1]
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, fmt.Errorf("ss unreconized: host:port -- %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("ss unreconized: invalid port -- %s", port)
+	}
+	link.Add, link.Port = host, uint16(p)
+
+	if query != "" {
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		if plugin := q.Get("plugin"); plugin != "" {
+			po := strings.SplitN(plugin, ";", 2)
+			link.Plugin = po[0]
+			if len(po) == 2 {
+				link.PluginOpts = po[1]
+			}
+		}
+	}
+	return link, nil
+}
+
+// LinkStr serializes the link to "sip002" (default) or "legacy" format
+func (v SSLink) LinkStr(linkType string) string {
+	hostport := net.JoinHostPort(v.Add, strconv.Itoa(int(v.Port)))
+	fragment := ""
+	if v.Ps != "" {
+		fragment = "#" + url.PathEscape(v.Ps)
+	}
+	if strings.ToLower(linkType) == "legacy" {
+		s := base64.StdEncoding.EncodeToString([]byte(v.Method + ":" + v.Password + "@" + hostport))
+		return "ss://" + s + fragment
+	}
+	s := "ss://" + base64.RawURLEncoding.EncodeToString([]byte(v.Method+":"+v.Password)) + "@" + hostport
+	if v.Plugin != "" {
+		plugin := v.Plugin
+		if v.PluginOpts != "" {
+			plugin += ";" + v.PluginOpts
+		}
+		s += "/?plugin=" + url.QueryEscape(plugin)
+	}
+	return s + fragment
+}
+
+func (v SSLink) String() string {
+	return fmt.Sprintf("ss|%s|%s|%d - (%s)", v.Method, v.Add, v.Port, v.Ps)
+}
+
+// Protocol implements ProxyLink
+func (v SSLink) Protocol() string {
+	return "shadowsocks"
+}
+
+// Remarks implements ProxyLink
+func (v SSLink) Remarks() string {
+	return v.Ps
+}
+
+// Server implements ProxyLink
+func (v SSLink) Server() (string, string) {
+	return v.Add, strconv.Itoa(int(v.Port))
+}
+
+// DetailStr returns human readable string of SSLink
+func (v SSLink) DetailStr() string {
+	plugin := v.Plugin
+	if v.PluginOpts != "" {
+		plugin += ";" + v.PluginOpts
+	}
+	return fmt.Sprintf("Protocol: shadowsocks\nAddr: %s\nPort: %d\nMethod: %s\nPlugin: %s\nPS: %s\n", v.Add, v.Port, v.Method, plugin, v.Ps)
+}
+
+// ShareLink implements ProxyLink
+func (v SSLink) ShareLink() string {
+	if v.OrigLink != "" {
+		return v.OrigLink
+	}
+	return v.LinkStr("sip002")
+}
+
+// ToOutbound implements ProxyLink
+func (v SSLink) ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error) {
+	return SS2Outbound(&v, usemux)
+}
+
+// SS2Outbound converts shadowsocks link to *OutboundDetourConfig.
+// Only v2ray-plugin can be represented by v2ray transports.
+func SS2Outbound(v *SSLink, usemux bool) (*conf.OutboundDetourConfig, error) {
+	out := &conf.OutboundDetourConfig{}
+	out.Protocol = "shadowsocks"
+	out.MuxSettings = muxConfig(usemux)
+
+	switch v.Plugin {
+	case "":
+	case "v2ray-plugin", "xray-plugin":
+		t := &transportInfo{Net: "ws"}
+		for _, opt := range strings.Split(v.PluginOpts, ";") {
+			kv := strings.SplitN(opt, "=", 2)
+			switch kv[0] {
+			case "tls":
+				t.TLS = "tls"
+			case "mode":
+				if len(kv) == 2 && kv[1] == "quic" {
+					t.Net = "quic"
+				}
+			case "host":
+				if len(kv) == 2 {
+					t.Host = kv[1]
+				}
+			case "path":
+				if len(kv) == 2 {
+					t.Path = kv[1]
+				}
+			}
+		}
+		if t.Net == "quic" {
+			return nil, fmt.Errorf("ss plugin unsupported: %s;%s", v.Plugin, v.PluginOpts)
+		}
+		s, err := streamConfig(t)
+		if err != nil {
+			return nil, err
+		}
+		out.StreamSetting = s
+	default:
+		return nil, fmt.Errorf("ss plugin unsupported: %s", v.Plugin)
+	}
+
+	type server struct {
+		Address  string `json:"address"`
+		Port     uint16 `json:"port"`
+		Method   string `json:"method"`
+		Password string `json:"password"`
+	}
+	settings, err := json.Marshal(map[string][]*server{
+		"servers": {{
+			Address:  v.Add,
+			Port:     v.Port,
+			Method:   v.Method,
+			Password: v.Password,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	oset := json.RawMessage(settings)
+	out.Settings = &oset
+	return out, nil
+}
+
+// LinksFromSIP008 parses servers in SIP008 json document
+func LinksFromSIP008(content []byte) ([]ProxyLink, error) {
+	type server struct {
+		ID         string `json:"id"`
+		Remarks    string `json:"remarks"`
+		Server     string `json:"server"`
+		ServerPort uint16 `json:"server_port"`
+		Password   string `json:"password"`
+		Method     string `json:"method"`
+		Plugin     string `json:"plugin"`
+		PluginOpts string `json:"plugin_opts"`
+	}
+	doc := &struct {
+		Version int       `json:"version"`
+		Servers []*server `json:"servers"`
+	}{}
+	if err := json.Unmarshal(content, doc); err != nil {
+		return nil, err
+	}
+	links := make([]ProxyLink, 0, len(doc.Servers))
+	for _, s := range doc.Servers {
+		if s == nil {
+			continue
+		}
+		if s.Server == "" || s.ServerPort == 0 || s.Method == "" {
+			return nil, fmt.Errorf("ss unreconized: incomplete server in SIP008 -- %s", s.Remarks)
+		}
+		links = append(links, &SSLink{
+			Method:     strings.ToLower(s.Method),
+			Password:   s.Password,
+			Add:        s.Server,
+			Port:       s.ServerPort,
+			Plugin:     s.Plugin,
+			PluginOpts: s.PluginOpts,
+			Ps:         s.Remarks,
+		})
+	}
+	return links, nil
+}
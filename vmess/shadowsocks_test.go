@@ -0,0 +1,82 @@
+package vmess
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseShadowsocks(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want *SSLink
+	}{
+		{
+			"sip002",
+			"ss://YWVzLTI1Ni1nY206cGFzc0B3b3Jk@1.2.3.4:8388#my%20ss",
+			&SSLink{Method: "aes-256-gcm", Password: "pass@word", Add: "1.2.3.4", Port: 8388, Ps: "my ss"},
+		},
+		{
+			"sip002 plugin",
+			"ss://YWVzLTI1Ni1nY206cGFzcw@example.com:443/?plugin=v2ray-plugin%3Btls%3Bhost%3Dexample.com#ws",
+			&SSLink{Method: "aes-256-gcm", Password: "pass", Add: "example.com", Port: 443, Plugin: "v2ray-plugin", PluginOpts: "tls;host=example.com", Ps: "ws"},
+		},
+		{
+			"sip002 plain userinfo",
+			"ss://2022-blake3-aes-128-gcm:a2V5@[::1]:8388",
+			&SSLink{Method: "2022-blake3-aes-128-gcm", Password: "a2V5", Add: "::1", Port: 8388},
+		},
+		{
+			"legacy",
+			"ss://YWVzLTI1Ni1nY206cGFzc0B3b3JkQDEuMi4zLjQ6ODM4OA#legacy",
+			&SSLink{Method: "aes-256-gcm", Password: "pass@word", Add: "1.2.3.4", Port: 8388, Ps: "legacy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseShadowsocks(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.OrigLink = tt.args
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+			for _, format := range []string{"sip002", "legacy"} {
+				if format == "legacy" && got.Plugin != "" {
+					continue
+				}
+				again, err := ParseShadowsocks(got.LinkStr(format))
+				if err != nil {
+					t.Fatal(err)
+				}
+				again.OrigLink = got.OrigLink
+				if d := cmp.Diff(got, again); d != "" {
+					t.Errorf("%s: %s", format, d)
+				}
+			}
+		})
+	}
+}
+
+func TestSS2Outbound(t *testing.T) {
+	lk, err := ParseShadowsocks("ss://YWVzLTI1Ni1nY206cGFzcw@example.com:443/?plugin=obfs-local%3Bobfs%3Dhttp#obfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lk.ToOutbound(false); err == nil {
+		t.Error("expects error of unsupported plugin")
+	}
+	lk.Plugin, lk.PluginOpts = "v2ray-plugin", "tls;host=cdn.example.com;path=/ws"
+	out, err := lk.ToOutbound(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.StreamSetting.WSSettings == nil || out.StreamSetting.WSSettings.Path != "/ws" {
+		t.Errorf("want ws transport with path /ws, got %+v", out.StreamSetting)
+	}
+	if out.StreamSetting.TLSSettings == nil || out.StreamSetting.TLSSettings.ServerName != "cdn.example.com" {
+		t.Errorf("want tls with server name cdn.example.com, got %+v", out.StreamSetting.TLSSettings)
+	}
+}
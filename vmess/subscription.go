@@ -1,6 +1,7 @@
 package vmess
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -12,10 +13,13 @@ import (
 	"strings"
 
 	"github.com/qjebbs/v2tool/files"
-	"v2ray.com/core/infra/conf"
+	"github.com/v2fly/v2ray-core/v5/infra/conf/cfgcommon/socketcfg"
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
 )
 
 // Subscription represents a subscription config
+//
+// Deprecated: use subscription.Subscription, which has the fetch options.
 type Subscription struct {
 	Tag    string `json:"tag"`
 	URL    string `json:"url"`
@@ -24,6 +28,8 @@ type Subscription struct {
 }
 
 // SubscriptionConfig represents a subscription json
+//
+// Deprecated: use subscription.Config.
 type SubscriptionConfig struct {
 	Subscriptions []*Subscription `json:"subscriptions"`
 }
@@ -37,6 +43,10 @@ Match: %s`,
 }
 
 // FetchSubscriptions fetches subscription specified by "conf", and generating json files to "outdir"
+//
+// Deprecated: use subscription.Fetch. This one is kept for existing callers,
+// without the fetch options, dry run, probing and api. It can't wrap
+// subscription.Fetch, since that package imports this one.
 func FetchSubscriptions(conf string, outdir string, socketMark int32) error {
 	filesMap, err := getFilesMap(outdir)
 	if err != nil {
@@ -98,11 +108,13 @@ func FetchSubscriptions(conf string, outdir string, socketMark int32) error {
 			return err
 		}
 		for _, link := range links {
-			out, err := Link2Outbound(link, false)
+			out, err := link.ToOutbound(false)
 			if err != nil {
-				return err
+				// e.g.: ss links with plugins which v2ray can't represent
+				fmt.Printf("Skipped: %s (%v)\n", link.Remarks(), err)
+				continue
 			}
-			out.Tag = asFileName(sub.Tag + " - " + link.Ps)
+			out.Tag = asFileName(sub.Tag + " - " + link.Remarks())
 			filename := out.Tag + ".json"
 			content, err := outbound2JSON(out, socketMark)
 			if err != nil {
@@ -166,8 +178,8 @@ func outbound2JSON(out *conf.OutboundDetourConfig, socketMark int32) ([]byte, er
 		if out.StreamSetting == nil {
 			out.StreamSetting = &conf.StreamConfig{}
 		}
-		out.StreamSetting.SocketSettings = &conf.SocketConfig{
-			Mark: socketMark,
+		out.StreamSetting.SocketSettings = &socketcfg.SocketConfig{
+			Mark: uint32(socketMark),
 		}
 	}
 	type outConfig struct {
@@ -181,7 +193,7 @@ func outbound2JSON(out *conf.OutboundDetourConfig, socketMark int32) ([]byte, er
 }
 
 // LinksFromSubscription downloads and parses links from a subscription URL
-func LinksFromSubscription(url string) ([]*Link, error) {
+func LinksFromSubscription(url string) ([]ProxyLink, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
@@ -191,18 +203,45 @@ func LinksFromSubscription(url string) ([]*Link, error) {
 	if err != nil {
 		return nil, err
 	}
-	decoded, err := base64Decode(string(body))
-	if err != nil {
-		return nil, err
+	return LinksFromContent(body)
+}
+
+// LinksFromContent parses links from subscription content, the format is sniffed from
+// the content, which could be base64 encoded share links, plain share links,
+// SIP008 json, v2ray json config, or clash yaml config
+func LinksFromContent(body []byte) ([]ProxyLink, error) {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		keys := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(trimmed, &keys); err != nil {
+			return nil, fmt.Errorf("invalid json subscription: %v", err)
+		}
+		if _, ok := keys["servers"]; ok {
+			return LinksFromSIP008(trimmed)
+		}
+		if _, ok := keys["outbounds"]; ok {
+			return LinksFromV2RayConfig(trimmed)
+		}
+		return nil, fmt.Errorf("unknown json subscription, neither SIP008 nor v2ray config")
+	}
+	if isClashConfig(trimmed) {
+		return LinksFromClash(trimmed)
 	}
-	content := string(decoded)
-	links := make([]*Link, 0)
+	content := string(trimmed)
+	if !isPlainLinks(content) {
+		decoded, err := base64Decode(content)
+		if err != nil {
+			return nil, err
+		}
+		content = string(decoded)
+	}
+	links := make([]ProxyLink, 0)
 	for _, line := range strings.Split(content, "\n") {
-		line = strings.Trim(line, " ")
-		if !strings.HasPrefix(line, "vmess://") {
+		line = strings.TrimSpace(line)
+		if !IsSupportedLink(line) {
 			continue
 		}
-		link, err := ParseVmess(line)
+		link, err := ParseLink(line)
 		if err != nil {
 			return nil, err
 		}
@@ -211,8 +250,18 @@ func LinksFromSubscription(url string) ([]*Link, error) {
 	return links, nil
 }
 
-func filterLinks(links []*Link, exclude string, include string) ([]*Link, error) {
-	lks := make([]*Link, 0)
+// isPlainLinks tells if content has any line of supported link
+func isPlainLinks(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if IsSupportedLink(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterLinks(links []ProxyLink, exclude string, include string) ([]ProxyLink, error) {
+	lks := make([]ProxyLink, 0)
 	var (
 		err        error
 		regExclude *regexp.Regexp
@@ -231,11 +280,11 @@ func filterLinks(links []*Link, exclude string, include string) ([]*Link, error)
 		}
 	}
 	for _, l := range links {
-		if regExclude != nil && regExclude.Match([]byte(l.Ps)) {
-			fmt.Printf("Ignored: %s\n", l.Ps)
+		if regExclude != nil && regExclude.Match([]byte(l.Remarks())) {
+			fmt.Printf("Ignored: %s\n", l.Remarks())
 			continue
 		}
-		if regInclude != nil && !regInclude.Match([]byte(l.Ps)) {
+		if regInclude != nil && !regInclude.Match([]byte(l.Remarks())) {
 			continue
 		}
 		lks = append(lks, l)
@@ -0,0 +1,83 @@
+package vmess
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestLinksFromContent(t *testing.T) {
+	lines := "trojan://pass@example.com:443#trojan\nss://YWVzLTI1Ni1nY206cGFzcw@example.com:8388#ss\n"
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			"base64",
+			base64.StdEncoding.EncodeToString([]byte(lines)),
+			[]string{"trojan", "ss"},
+		},
+		{
+			"plain",
+			"\n" + lines,
+			[]string{"trojan", "ss"},
+		},
+		{
+			"surge and quantumult x",
+			"[Proxy]\nDIRECT = direct\nsurge = vmess, example.com, 443, username=27b8a625-4f4b-4428-9f0f-8a2317db7c79, ws=true\n" +
+				"vmess=example.com:443, method=none, password=27b8a625-4f4b-4428-9f0f-8a2317db7c79, obfs=wss, tag=quanx\n",
+			[]string{"surge", "quanx"},
+		},
+		{
+			"sip008",
+			`{
+				"version": 1,
+				"servers": [{
+					"id": "27b8a625-4f4b-4428-9f0f-8a2317db7c79",
+					"remarks": "sip008",
+					"server": "example.com",
+					"server_port": 8388,
+					"password": "pass",
+					"method": "AES-256-GCM"
+				}]
+			}`,
+			[]string{"sip008"},
+		},
+		{
+			"v2ray config",
+			`{
+				"outbounds": [{
+					"tag": "vmess out",
+					"protocol": "vmess",
+					"settings": {"vnext": [{"address": "example.com", "port": 443, "users": [{"id": "27b8a625-4f4b-4428-9f0f-8a2317db7c79"}]}]}
+				}, {
+					"tag": "direct",
+					"protocol": "freedom"
+				}]
+			}`,
+			[]string{"vmess out"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LinksFromContent([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d links, want %d", len(got), len(tt.want))
+			}
+			for i, lk := range got {
+				if lk.Remarks() != tt.want[i] {
+					t.Errorf("link %d: got %q, want %q", i, lk.Remarks(), tt.want[i])
+				}
+				if _, err := lk.ToOutbound(false); err != nil {
+					t.Errorf("link %d: %v", i, err)
+				}
+			}
+		})
+	}
+	if _, err := LinksFromContent([]byte(`{"foo": 1}`)); err == nil {
+		t.Error("want error for unknown json")
+	}
+}
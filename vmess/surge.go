@@ -0,0 +1,106 @@
+package vmess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isSurgeLine tells if s is a surge vmess proxy line, in the format of
+// name = vmess, example.com, 443, username=uuid, ws=true, tls=true
+func isSurgeLine(s string) bool {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(parts[1]), "vmess,")
+}
+
+// NewSurgeVmess parses Surge vmess proxy line to VmessLink
+func NewSurgeVmess(line string) (*Link, error) {
+	line = strings.TrimSpace(line)
+	if !isSurgeLine(line) {
+		return nil, fmt.Errorf("surge vmess unreconized: %s", line)
+	}
+	psn := strings.SplitN(line, "=", 2)
+	params := strings.Split(psn[1], ",")
+	for i := range params {
+		params[i] = strings.TrimSpace(params[i])
+	}
+	if len(params) < 4 {
+		return nil, fmt.Errorf("surge vmess unreconized: %s", line)
+	}
+	v := &Link{
+		Ver:      "2",
+		Ps:       strings.TrimSpace(psn[0]),
+		Add:      params[1],
+		Port:     params[2],
+		Aid:      "0",
+		Scy:      "auto",
+		Net:      "tcp",
+		Type:     "none",
+		OrigLink: line,
+	}
+	for _, pkv := range params[3:] {
+		kvp := strings.SplitN(pkv, "=", 2)
+		if len(kvp) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(kvp[1])
+		switch strings.TrimSpace(kvp[0]) {
+		case "username":
+			v.ID = val
+		case "ws":
+			if val == "true" {
+				v.Net = "ws"
+			}
+		case "ws-path":
+			v.Path = val
+		case "ws-headers":
+			for _, h := range strings.Split(val, "|") {
+				kv := strings.SplitN(h, ":", 2)
+				if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "Host") {
+					v.Host = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+				}
+			}
+		case "tls":
+			if val == "true" {
+				v.TLS = "tls"
+			}
+		case "sni":
+			v.Sni = val
+		}
+	}
+	if v.ID == "" {
+		return nil, fmt.Errorf("surge vmess unreconized: no username -- %s", line)
+	}
+	return v, nil
+}
+
+func (v Link) asSurge() string {
+	parts := []string{
+		fmt.Sprintf("%s = vmess", v.Ps),
+		v.Add,
+		fmt.Sprintf("%v", v.Port),
+		"username=" + v.ID,
+	}
+	if v.Net == "ws" {
+		parts = append(parts, "ws=true")
+		if v.Path != "" {
+			parts = append(parts, "ws-path="+v.Path)
+		}
+		if v.Host != "" {
+			parts = append(parts, "ws-headers=Host:"+v.Host)
+		}
+	}
+	if v.TLS == "tls" {
+		parts = append(parts, "tls=true")
+		if v.Sni != "" {
+			parts = append(parts, "sni="+v.Sni)
+		}
+		parts = append(parts, "skip-cert-verify=true")
+	}
+	if !v.hasAid() {
+		parts = append(parts, "vmess-aead=true")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,184 @@
+package vmess
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// TrojanLink represents a parsed trojan link, in the format of
+// trojan://password@host:port?sni=example.com&type=ws#remarks
+type TrojanLink struct {
+	Password string
+	Add      string
+	Port     uint16
+	// Net is the transport, in query "type"
+	Net string
+	// TLS is the security, in query "security", defaults to "tls"
+	TLS  string
+	Host string
+	Path string
+	SNI  string
+	// ServiceName and Mode are for grpc transport
+	ServiceName string
+	Mode        string
+	Ps          string
+	OrigLink    string
+}
+
+// ParseTrojan parses trojan link
+func ParseTrojan(trojan string) (*TrojanLink, error) {
+	if !strings.HasPrefix(trojan, "trojan://") {
+		return nil, fmt.Errorf("trojan unreconized: %s", trojan)
+	}
+	u, err := url.Parse(trojan)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("trojan unreconized: no password -- %s", trojan)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("trojan unreconized: invalid port -- %s", trojan)
+	}
+	link := &TrojanLink{
+		Password: u.User.Username(),
+		Add:      u.Hostname(),
+		Port:     uint16(port),
+		Ps:       u.Fragment,
+		OrigLink: trojan,
+	}
+	q := u.Query()
+	link.Net = q.Get("type")
+	link.TLS = q.Get("security")
+	link.Host = q.Get("host")
+	link.Path = q.Get("path")
+	link.SNI = q.Get("sni")
+	link.ServiceName = q.Get("serviceName")
+	link.Mode = q.Get("mode")
+	if link.SNI == "" {
+		link.SNI = q.Get("peer")
+	}
+	if link.Net == "" {
+		link.Net = "tcp"
+	}
+	if link.TLS == "" {
+		link.TLS = "tls"
+	}
+	return link, nil
+}
+
+// LinkStr serializes the link to trojan:// format
+func (v TrojanLink) LinkStr() string {
+	q := url.Values{}
+	if v.Net != "" && v.Net != "tcp" {
+		q.Set("type", v.Net)
+	}
+	if v.TLS != "" && v.TLS != "tls" {
+		q.Set("security", v.TLS)
+	}
+	if v.Host != "" {
+		q.Set("host", v.Host)
+	}
+	if v.Path != "" {
+		q.Set("path", v.Path)
+	}
+	if v.SNI != "" {
+		q.Set("sni", v.SNI)
+	}
+	if v.ServiceName != "" {
+		q.Set("serviceName", v.ServiceName)
+	}
+	if v.Mode != "" {
+		q.Set("mode", v.Mode)
+	}
+	u := url.URL{
+		Scheme:   "trojan",
+		User:     url.User(v.Password),
+		Host:     net.JoinHostPort(v.Add, strconv.Itoa(int(v.Port))),
+		RawQuery: q.Encode(),
+		Fragment: v.Ps,
+	}
+	return u.String()
+}
+
+func (v TrojanLink) String() string {
+	return fmt.Sprintf("trojan|%s|%s|%d - (%s)", v.Net, v.Add, v.Port, v.Ps)
+}
+
+// Protocol implements ProxyLink
+func (v TrojanLink) Protocol() string {
+	return "trojan"
+}
+
+// Remarks implements ProxyLink
+func (v TrojanLink) Remarks() string {
+	return v.Ps
+}
+
+// Server implements ProxyLink
+func (v TrojanLink) Server() (string, string) {
+	return v.Add, strconv.Itoa(int(v.Port))
+}
+
+// DetailStr returns human readable string of TrojanLink
+func (v TrojanLink) DetailStr() string {
+	return fmt.Sprintf("Protocol: trojan\nNet: %s\nAddr: %s\nPort: %d\nSNI: %s\nTLS: %s\nPS: %s\n", v.Net, v.Add, v.Port, v.SNI, v.TLS, v.Ps)
+}
+
+// ShareLink implements ProxyLink
+func (v TrojanLink) ShareLink() string {
+	if v.OrigLink != "" {
+		return v.OrigLink
+	}
+	return v.LinkStr()
+}
+
+// ToOutbound implements ProxyLink
+func (v TrojanLink) ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error) {
+	return Trojan2Outbound(&v, usemux)
+}
+
+// Trojan2Outbound converts trojan link to *OutboundDetourConfig
+func Trojan2Outbound(v *TrojanLink, usemux bool) (*conf.OutboundDetourConfig, error) {
+	out := &conf.OutboundDetourConfig{}
+	out.Protocol = "trojan"
+	out.MuxSettings = muxConfig(usemux)
+	s, err := streamConfig(&transportInfo{
+		Net:         v.Net,
+		Host:        v.Host,
+		Path:        v.Path,
+		TLS:         v.TLS,
+		SNI:         v.SNI,
+		ServiceName: v.ServiceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.StreamSetting = s
+
+	type server struct {
+		Address  string `json:"address"`
+		Port     uint16 `json:"port"`
+		Password string `json:"password"`
+	}
+	settings, err := json.Marshal(map[string][]*server{
+		"servers": {{
+			Address:  v.Add,
+			Port:     v.Port,
+			Password: v.Password,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	oset := json.RawMessage(settings)
+	out.Settings = &oset
+	return out, nil
+}
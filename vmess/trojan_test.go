@@ -0,0 +1,81 @@
+package vmess
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/v2fly/v2ray-core/v5/common/serial"
+	"github.com/v2fly/v2ray-core/v5/proxy/trojan"
+)
+
+func TestParseTrojan(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want *TrojanLink
+	}{
+		{
+			"tcp",
+			"trojan://pass%40word@example.com:443?peer=sni.example.com#node%201",
+			&TrojanLink{Password: "pass@word", Add: "example.com", Port: 443, Net: "tcp", TLS: "tls", SNI: "sni.example.com", Ps: "node 1"},
+		},
+		{
+			"ws",
+			"trojan://pass@example.com:443?sni=sni.example.com&type=ws&host=cdn.example.com&path=%2Fws",
+			&TrojanLink{Password: "pass", Add: "example.com", Port: 443, Net: "ws", TLS: "tls", Host: "cdn.example.com", Path: "/ws", SNI: "sni.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrojan(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.OrigLink = tt.args
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+			again, err := ParseLink(got.LinkStr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			again.(*TrojanLink).OrigLink = got.OrigLink
+			if d := cmp.Diff(got, again); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestTrojan2OutboundBuild(t *testing.T) {
+	link, err := ParseTrojan("trojan://pass%40word@example.com:443?sni=sni.example.com&type=ws&host=cdn.example.com&path=%2Fws#node%201")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := link.ToOutbound(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob, err := out.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := serial.GetInstanceOf(ob.ProxySettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := inst.(*trojan.ClientConfig).Server
+	if len(servers) != 1 || len(servers[0].User) != 1 {
+		t.Fatalf("got servers %v", servers)
+	}
+	if addr, port := servers[0].Address.AsAddress().String(), servers[0].Port; addr != "example.com" || port != 443 {
+		t.Errorf("got server %s:%d", addr, port)
+	}
+	acc, err := serial.GetInstanceOf(servers[0].User[0].Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := acc.(*trojan.Account).Password; p != "pass@word" {
+		t.Errorf("got password %s", p)
+	}
+}
@@ -0,0 +1,121 @@
+package vmess
+
+import (
+	"encoding/json"
+	"fmt"
+
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// OutboundLink is an outbound taken from a v2ray json config.
+// It has no share link, ShareLink() returns the json config of itself
+type OutboundLink struct {
+	Outbound *conf.OutboundDetourConfig
+	// Raw is the original json of the outbound
+	Raw json.RawMessage
+}
+
+// LinksFromV2RayConfig gets the proxy outbounds in a v2ray json config,
+// outbounds without servers (e.g.: freedom, blackhole) are ignored.
+// vmess outbounds are converted to *Link if possible, others are *OutboundLink
+func LinksFromV2RayConfig(content []byte) ([]ProxyLink, error) {
+	c := &struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+	}{}
+	if err := json.Unmarshal(content, c); err != nil {
+		return nil, err
+	}
+	links := make([]ProxyLink, 0)
+	for _, raw := range c.Outbounds {
+		out := &conf.OutboundDetourConfig{}
+		if err := json.Unmarshal(raw, out); err != nil {
+			return nil, err
+		}
+		if out.Protocol == "vmess" {
+			if lk, err := Outbound2Link(out); err == nil {
+				links = append(links, lk)
+				continue
+			}
+		}
+		lk := &OutboundLink{Outbound: out, Raw: raw}
+		if addr, _ := lk.Server(); addr == "" {
+			continue
+		}
+		links = append(links, lk)
+	}
+	return links, nil
+}
+
+func (v OutboundLink) String() string {
+	addr, port := v.Server()
+	return fmt.Sprintf("%s|%s|%s - (%s)", v.Outbound.Protocol, addr, port, v.Outbound.Tag)
+}
+
+// Protocol implements ProxyLink
+func (v OutboundLink) Protocol() string {
+	return v.Outbound.Protocol
+}
+
+// Remarks implements ProxyLink, it's the tag of the outbound
+func (v OutboundLink) Remarks() string {
+	return v.Outbound.Tag
+}
+
+// Server implements ProxyLink, it's the first server in settings
+func (v OutboundLink) Server() (string, string) {
+	if v.Outbound.Settings == nil {
+		return "", ""
+	}
+	type server struct {
+		Address string          `json:"address"`
+		Port    json.RawMessage `json:"port"`
+	}
+	s := &struct {
+		Vnext   []*server `json:"vnext"`
+		Servers []*server `json:"servers"`
+	}{}
+	if err := json.Unmarshal(*v.Outbound.Settings, s); err != nil {
+		return "", ""
+	}
+	for _, list := range [][]*server{s.Vnext, s.Servers} {
+		if len(list) > 0 && list[0] != nil {
+			return list[0].Address, trimQuote(string(list[0].Port))
+		}
+	}
+	return "", ""
+}
+
+func trimQuote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// DetailStr returns human readable string of OutboundLink
+func (v OutboundLink) DetailStr() string {
+	addr, port := v.Server()
+	net := ""
+	if v.Outbound.StreamSetting != nil && v.Outbound.StreamSetting.Network != nil {
+		net = string(*v.Outbound.StreamSetting.Network)
+	}
+	return fmt.Sprintf("Protocol: %s\nNet: %s\nAddr: %s\nPort: %s\nTag: %s\n", v.Outbound.Protocol, net, addr, port, v.Outbound.Tag)
+}
+
+// ShareLink implements ProxyLink, it returns the json config of the outbound
+func (v OutboundLink) ShareLink() string {
+	b, err := json.Marshal(map[string][]json.RawMessage{
+		"outbounds": {v.Raw},
+	})
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ToOutbound implements ProxyLink
+func (v OutboundLink) ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error) {
+	out := *v.Outbound
+	out.MuxSettings = muxConfig(usemux)
+	return &out, nil
+}
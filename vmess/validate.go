@@ -0,0 +1,147 @@
+package vmess
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FieldError is a validation error of a field of link
+type FieldError struct {
+	// Field is the json name of the field, e.g. "port"
+	Field string
+	Value interface{}
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s (got %q)", e.Field, e.Msg, fmt.Sprintf("%v", e.Value))
+}
+
+// FieldErrors is a list of field errors, which implements error
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e)+1)
+	msgs = append(msgs, "invalid link:")
+	for _, fe := range e {
+		msgs = append(msgs, "  "+fe.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var (
+	knownNets = []string{"tcp", "kcp", "ws", "h2", "http", "quic", "grpc"}
+	// header types of kcp and quic
+	knownHeaders = []string{"none", "srtp", "utp", "wechat-video", "dtls", "wireguard"}
+	knownScys    = []string{"auto", "aes-128-gcm", "chacha20-poly1305", "none", "zero"}
+)
+
+// Validate checks the fields of link without changing it, see Normalized
+// for the port and aid in int. It returns nil if the link is valid
+func (v *Link) Validate() FieldErrors {
+	errs := make(FieldErrors, 0)
+	fail := func(field string, value interface{}, format string, a ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Value: value, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	if strings.TrimSpace(v.Add) == "" {
+		fail("add", v.Add, "address is empty")
+	}
+	if port, err := toInt(v.Port); err != nil {
+		fail("port", v.Port, "not an integer")
+	} else if port < 1 || port > 65535 {
+		fail("port", v.Port, "out of range 1-65535")
+	}
+	if !uuidRegexp.MatchString(v.ID) {
+		fail("id", v.ID, "not a uuid")
+	}
+	if aid, err := toInt(v.Aid); err != nil {
+		fail("aid", v.Aid, "not an integer")
+	} else if aid < 0 || aid > 65535 {
+		fail("aid", v.Aid, "out of range 0-65535")
+	}
+	if v.Scy != "" && !contains(knownScys, v.Scy) {
+		fail("scy", v.Scy, "unknown security, should be one of %s", strings.Join(knownScys, ", "))
+	}
+
+	net := v.Net
+	if net == "" {
+		net = "tcp"
+	}
+	if !contains(knownNets, net) {
+		fail("net", v.Net, "unknown network, should be one of %s", strings.Join(knownNets, ", "))
+	}
+	typ := v.Type
+	if typ == "" {
+		typ = "none"
+	}
+	switch net {
+	case "tcp":
+		if typ != "none" && typ != "http" {
+			fail("type", v.Type, "unknown tcp header type, should be none or http")
+		}
+	case "kcp", "quic":
+		if !contains(knownHeaders, typ) {
+			fail("type", v.Type, "unknown %s header type, should be one of %s", net, strings.Join(knownHeaders, ", "))
+		}
+		if net == "quic" && v.Host != "" && !contains([]string{"none", "aes-128-gcm", "chacha20-poly1305"}, v.Host) {
+			fail("host", v.Host, "unknown quic security, should be none, aes-128-gcm or chacha20-poly1305")
+		}
+	case "grpc":
+		if typ != "none" && typ != "gun" && typ != "multi" {
+			fail("type", v.Type, "unknown grpc mode, should be gun or multi")
+		}
+	case "ws", "h2", "http":
+		if typ != "none" {
+			fail("type", v.Type, "header type is not applicable to %s", net)
+		}
+	}
+	switch v.TLS {
+	case "", "none", "tls":
+	default:
+		fail("tls", v.TLS, "unknown security, should be tls or empty")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// toInt converts port or aid to int, nil and "" are taken as 0
+func toInt(i interface{}) (int, error) {
+	switch n := i.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return n, nil
+	case float64:
+		if n != float64(int(n)) {
+			return 0, fmt.Errorf("not an integer: %v", n)
+		}
+		return int(n), nil
+	case json.Number:
+		return toInt(n.String())
+	case string:
+		n = strings.TrimSpace(n)
+		if n == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("not an integer: %v", i)
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package vmess
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkValidate(t *testing.T) {
+	const id = "27b8a625-4f4b-4428-9f0f-8a2317db7c79"
+	tests := []struct {
+		name string
+		link *Link
+		want []string // fields of errors
+	}{
+		{"valid", &Link{Add: "example.com", Port: "443", ID: id, Aid: "0", Net: "ws", Type: "none", TLS: "tls"}, nil},
+		{"number port", &Link{Add: "example.com", Port: float64(443), ID: id, Aid: json.Number("4")}, nil},
+		{"empty aid", &Link{Add: "example.com", Port: 443, ID: id, Net: "kcp", Type: "wechat-video"}, nil},
+		{"empty add", &Link{Port: "443", ID: id}, []string{"add"}},
+		{"bad port", &Link{Add: "example.com", Port: "https", ID: id}, []string{"port"}},
+		{"port range", &Link{Add: "example.com", Port: 65536, ID: id}, []string{"port"}},
+		{"bad id", &Link{Add: "example.com", Port: "443", ID: "27b8a625"}, []string{"id"}},
+		{"bad aid", &Link{Add: "example.com", Port: "443", ID: id, Aid: "-1"}, []string{"aid"}},
+		{"bad scy", &Link{Add: "example.com", Port: "443", ID: id, Scy: "rc4"}, []string{"scy"}},
+		{"bad net", &Link{Add: "example.com", Port: "443", ID: id, Net: "udp"}, []string{"net"}},
+		{"bad tcp type", &Link{Add: "example.com", Port: "443", ID: id, Net: "tcp", Type: "srtp"}, []string{"type"}},
+		{"bad grpc mode", &Link{Add: "example.com", Port: "443", ID: id, Net: "grpc", Type: "http"}, []string{"type"}},
+		{"bad quic security", &Link{Add: "example.com", Port: "443", ID: id, Net: "quic", Host: "example.com"}, []string{"host"}},
+		{"bad tls", &Link{Add: "example.com", Port: "443", ID: id, TLS: "1"}, []string{"tls"}},
+		{"multiple", &Link{Port: "0", ID: "x", TLS: "xtls"}, []string{"add", "port", "id", "tls"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := *tt.link
+			errs := tt.link.Validate()
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Field)
+			}
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Fatal(d)
+			}
+			if *tt.link != orig {
+				t.Errorf("link changed: %#v", tt.link)
+			}
+		})
+	}
+}
+
+func TestNewVnVmessEmpty(t *testing.T) {
+	for _, s := range []string{"vmess://e30=", "vmess://eyJhZGQiOiJleGFtcGxlLmNvbSJ9"} {
+		if _, err := NewVnVmess(s); err == nil {
+			t.Errorf("want error for %s", s)
+		}
+	}
+}
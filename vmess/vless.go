@@ -0,0 +1,221 @@
+package vmess
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
+)
+
+// VlessLink represents a parsed vless link, in the format of
+// vless://uuid@host:port?type=ws&security=tls&path=/#remarks
+type VlessLink struct {
+	ID         string
+	Add        string
+	Port       uint16
+	Encryption string
+	Flow       string
+	// Net is the transport, in query "type"
+	Net string
+	// TLS is the security, in query "security"
+	TLS  string
+	Type string
+	Host string
+	Path string
+	SNI  string
+	// ServiceName and Mode are for grpc transport
+	ServiceName string
+	Mode        string
+	Ps          string
+	OrigLink    string
+}
+
+// ParseVless parses vless link
+func ParseVless(vless string) (*VlessLink, error) {
+	if !strings.HasPrefix(vless, "vless://") {
+		return nil, fmt.Errorf("vless unreconized: %s", vless)
+	}
+	u, err := url.Parse(vless)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("vless unreconized: no uuid -- %s", vless)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("vless unreconized: invalid port -- %s", vless)
+	}
+	link := &VlessLink{
+		ID:       u.User.Username(),
+		Add:      u.Hostname(),
+		Port:     uint16(port),
+		Ps:       u.Fragment,
+		OrigLink: vless,
+	}
+	q := u.Query()
+	link.Encryption = q.Get("encryption")
+	link.Flow = q.Get("flow")
+	link.Net = q.Get("type")
+	link.TLS = q.Get("security")
+	link.Type = q.Get("headerType")
+	link.Host = q.Get("host")
+	link.Path = q.Get("path")
+	link.SNI = q.Get("sni")
+	link.ServiceName = q.Get("serviceName")
+	link.Mode = q.Get("mode")
+	if link.Net == "" {
+		link.Net = "tcp"
+	}
+	if link.Net == "kcp" || link.Net == "quic" {
+		// seed and key are put in path for kcp and quic
+		if v := q.Get("seed"); v != "" {
+			link.Path = v
+		}
+		if v := q.Get("key"); v != "" {
+			link.Path = v
+		}
+	}
+	return link, nil
+}
+
+// LinkStr serializes the link to vless:// format
+func (v VlessLink) LinkStr() string {
+	q := url.Values{}
+	enc := v.Encryption
+	if enc == "" {
+		enc = "none"
+	}
+	q.Set("encryption", enc)
+	if v.Flow != "" {
+		q.Set("flow", v.Flow)
+	}
+	if v.Net != "" {
+		q.Set("type", v.Net)
+	}
+	if v.TLS != "" {
+		q.Set("security", v.TLS)
+	}
+	if v.Type != "" {
+		q.Set("headerType", v.Type)
+	}
+	if v.Host != "" {
+		q.Set("host", v.Host)
+	}
+	if v.Path != "" {
+		switch v.Net {
+		case "kcp":
+			q.Set("seed", v.Path)
+		case "quic":
+			q.Set("key", v.Path)
+		default:
+			q.Set("path", v.Path)
+		}
+	}
+	if v.SNI != "" {
+		q.Set("sni", v.SNI)
+	}
+	if v.ServiceName != "" {
+		q.Set("serviceName", v.ServiceName)
+	}
+	if v.Mode != "" {
+		q.Set("mode", v.Mode)
+	}
+	u := url.URL{
+		Scheme:   "vless",
+		User:     url.User(v.ID),
+		Host:     net.JoinHostPort(v.Add, strconv.Itoa(int(v.Port))),
+		RawQuery: q.Encode(),
+		Fragment: v.Ps,
+	}
+	return u.String()
+}
+
+func (v VlessLink) String() string {
+	return fmt.Sprintf("vless|%s|%s|%d - (%s)", v.Net, v.Add, v.Port, v.Ps)
+}
+
+// Protocol implements ProxyLink
+func (v VlessLink) Protocol() string {
+	return "vless"
+}
+
+// Remarks implements ProxyLink
+func (v VlessLink) Remarks() string {
+	return v.Ps
+}
+
+// Server implements ProxyLink
+func (v VlessLink) Server() (string, string) {
+	return v.Add, strconv.Itoa(int(v.Port))
+}
+
+// DetailStr returns human readable string of VlessLink
+func (v VlessLink) DetailStr() string {
+	return fmt.Sprintf("Protocol: vless\nNet: %s\nAddr: %s\nPort: %d\nUUID: %s\nFlow: %s\nTLS: %s\nPS: %s\n", v.Net, v.Add, v.Port, v.ID, v.Flow, v.TLS, v.Ps)
+}
+
+// ShareLink implements ProxyLink
+func (v VlessLink) ShareLink() string {
+	if v.OrigLink != "" {
+		return v.OrigLink
+	}
+	return v.LinkStr()
+}
+
+// ToOutbound implements ProxyLink
+func (v VlessLink) ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error) {
+	return Vless2Outbound(&v, usemux)
+}
+
+// Vless2Outbound converts vless link to *OutboundDetourConfig
+func Vless2Outbound(v *VlessLink, usemux bool) (*conf.OutboundDetourConfig, error) {
+	out := &conf.OutboundDetourConfig{}
+	out.Protocol = "vless"
+	out.MuxSettings = muxConfig(usemux)
+	s, err := streamConfig(&transportInfo{
+		Net:         v.Net,
+		Type:        v.Type,
+		Host:        v.Host,
+		Path:        v.Path,
+		TLS:         v.TLS,
+		SNI:         v.SNI,
+		ServiceName: v.ServiceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.StreamSetting = s
+
+	enc := v.Encryption
+	if enc == "" {
+		enc = "none"
+	}
+	type user struct {
+		ID         string `json:"id"`
+		Encryption string `json:"encryption"`
+		Flow       string `json:"flow,omitempty"`
+	}
+	type server struct {
+		Address string  `json:"address"`
+		Port    uint16  `json:"port"`
+		Users   []*user `json:"users"`
+	}
+	settings, err := json.Marshal(map[string][]*server{
+		"vnext": {{
+			Address: v.Add,
+			Port:    v.Port,
+			Users:   []*user{{ID: v.ID, Encryption: enc, Flow: v.Flow}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	oset := json.RawMessage(settings)
+	out.Settings = &oset
+	return out, nil
+}
@@ -0,0 +1,128 @@
+package vmess
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/v2fly/v2ray-core/v5/common/serial"
+	"github.com/v2fly/v2ray-core/v5/proxy/vless"
+	"github.com/v2fly/v2ray-core/v5/proxy/vless/outbound"
+)
+
+func TestParseVless(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want *VlessLink
+	}{
+		{
+			"ws tls",
+			"vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?encryption=none&security=tls&sni=sni.example.com&type=ws&host=cdn.example.com&path=%2Fws#node%201",
+			&VlessLink{
+				ID:         "b831381d-6324-4d53-ad4f-8cda48b30811",
+				Add:        "example.com",
+				Port:       443,
+				Encryption: "none",
+				Net:        "ws",
+				TLS:        "tls",
+				Host:       "cdn.example.com",
+				Path:       "/ws",
+				SNI:        "sni.example.com",
+				Ps:         "node 1",
+			},
+		},
+		{
+			"grpc multi",
+			"vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?encryption=none&security=tls&type=grpc&serviceName=svc&mode=multi",
+			&VlessLink{
+				ID:          "b831381d-6324-4d53-ad4f-8cda48b30811",
+				Add:         "example.com",
+				Port:        443,
+				Encryption:  "none",
+				Net:         "grpc",
+				TLS:         "tls",
+				ServiceName: "svc",
+				Mode:        "multi",
+			},
+		},
+		{
+			"tcp ipv6",
+			"vless://b831381d-6324-4d53-ad4f-8cda48b30811@[::1]:8443?flow=xtls-rprx-direct&security=xtls",
+			&VlessLink{
+				ID:   "b831381d-6324-4d53-ad4f-8cda48b30811",
+				Add:  "::1",
+				Port: 8443,
+				Flow: "xtls-rprx-direct",
+				Net:  "tcp",
+				TLS:  "xtls",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVless(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.OrigLink = tt.args
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Error(d)
+			}
+			// serialize and parse again
+			again, err := ParseVless(got.LinkStr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			again.OrigLink = got.OrigLink
+			if again.Encryption == "none" && got.Encryption == "" {
+				again.Encryption = ""
+			}
+			if d := cmp.Diff(got, again); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+
+	for _, s := range []string{
+		"vless://example.com:443",
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com",
+		"vmess://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443",
+	} {
+		if _, err := ParseVless(s); err == nil {
+			t.Errorf("ParseVless(%q) expects error", s)
+		}
+	}
+}
+
+func TestVless2OutboundBuild(t *testing.T) {
+	link, err := ParseVless("vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?security=tls&sni=sni.example.com&type=ws&host=cdn.example.com&path=%2Fws#node%201")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := link.ToOutbound(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob, err := out.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := serial.GetInstanceOf(ob.ProxySettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vnext := inst.(*outbound.Config).Vnext
+	if len(vnext) != 1 || len(vnext[0].User) != 1 {
+		t.Fatalf("got vnext %v", vnext)
+	}
+	if addr, port := vnext[0].Address.AsAddress().String(), vnext[0].Port; addr != "example.com" || port != 443 {
+		t.Errorf("got server %s:%d", addr, port)
+	}
+	acc, err := serial.GetInstanceOf(vnext[0].User[0].Account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := acc.(*vless.Account); a.Id != link.ID || a.Encryption != "none" {
+		t.Errorf("got account %s, encryption %s", a.Id, a.Encryption)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+
+	conf "github.com/v2fly/v2ray-core/v5/infra/conf/v4"
 )
 
 // Link represents a parsed vmess link
@@ -21,26 +23,49 @@ type Link struct {
 	Ps       string      `json:"ps"`
 	TLS      string      `json:"tls"`
 	Type     string      `json:"type"`
+	Scy      string      `json:"scy,omitempty"`  // user security, e.g. "auto", "aes-128-gcm"
+	Sni      string      `json:"sni,omitempty"`  // tls server name, falls back to Host if empty
+	Alpn     string      `json:"alpn,omitempty"` // comma separated tls alpn
+	Fp       string      `json:"fp,omitempty"`   // tls fingerprint, not supported by v2ray-core
 	OrigLink string      `json:"-"`
 }
 
-// IsEqual tests if this vmess link is equal to another
+// IsEqual tests if this vmess link is equal to another, the remarks
+// are ignored, and defaults like empty net and "tcp" are taken as equal
 func (v *Link) IsEqual(c *Link) bool {
-	realNet := func(n string) string {
-		if n == "" {
-			return "tcp"
+	return v.Normalized() == c.Normalized()
+}
+
+// Normalized returns a copy of the link with the connection fields only:
+// the remarks, version and fingerprint are dropped, defaults like empty net
+// are filled, and port and aid are converted to int if they are integers
+func (v *Link) Normalized() Link {
+	or := func(s, def string) string {
+		if s == "" {
+			return def
 		}
-		return n
+		return s
 	}
-	if realNet(v.Net) != realNet(c.Net) {
-		return false
+	num := func(i interface{}) interface{} {
+		if n, err := toInt(i); err == nil {
+			return n
+		}
+		return fmt.Sprintf("%v", i)
 	}
-	if fmt.Sprintf("%v", c.Port) != fmt.Sprintf("%v", v.Port) {
-		return false
+	return Link{
+		Add:  v.Add,
+		Aid:  num(v.Aid),
+		Host: v.Host,
+		ID:   v.ID,
+		Net:  or(v.Net, "tcp"),
+		Path: v.Path,
+		Port: num(v.Port),
+		TLS:  or(v.TLS, "none"),
+		Type: or(v.Type, "none"),
+		Scy:  or(v.Scy, "auto"),
+		Sni:  v.Sni,
+		Alpn: v.Alpn,
 	}
-
-	return v.Add == c.Add && v.Aid == c.Aid && v.Host == c.Host && v.ID == c.ID &&
-		v.Path == c.Path && v.TLS == c.TLS && v.Type == c.Type
 }
 
 // LinkStr unmarshals VmessLink to string
@@ -52,6 +77,12 @@ func (v Link) LinkStr(linkType string) string {
 		return v.asRocketLink()
 	case "quan", "quantumult":
 		return v.asQuantumult()
+	case "quanx", "quantumultx":
+		return v.asQuantumultX()
+	case "surge":
+		return v.asSurge()
+	case "clash":
+		return v.asClash()
 	}
 
 	return ""
@@ -61,9 +92,37 @@ func (v Link) String() string {
 	return fmt.Sprintf("%s|%s|%v - (%s)", v.Net, v.Add, v.Port, v.Ps)
 }
 
+// Protocol implements ProxyLink
+func (v Link) Protocol() string {
+	return "vmess"
+}
+
+// Remarks implements ProxyLink
+func (v Link) Remarks() string {
+	return v.Ps
+}
+
+// Server implements ProxyLink
+func (v Link) Server() (string, string) {
+	return v.Add, fmt.Sprintf("%v", v.Port)
+}
+
+// ShareLink implements ProxyLink
+func (v Link) ShareLink() string {
+	if v.OrigLink != "" {
+		return v.OrigLink
+	}
+	return v.LinkStr("ng")
+}
+
+// ToOutbound implements ProxyLink
+func (v Link) ToOutbound(usemux bool) (*conf.OutboundDetourConfig, error) {
+	return Link2Outbound(&v, usemux)
+}
+
 // DetailStr returns human readable string of VmessLink
 func (v Link) DetailStr() string {
-	return fmt.Sprintf("Net: %s\nAddr: %s\nPort: %v\nUUID: %s\nType: %s\nTLS: %s\nPS: %s\n", v.Net, v.Add, v.Port, v.ID, v.Type, v.TLS, v.Ps)
+	return fmt.Sprintf("Net: %s\nAddr: %s\nPort: %v\nUUID: %s\nSecurity: %s\nType: %s\nTLS: %s\nSNI: %s\nPS: %s\n", v.Net, v.Add, v.Port, v.ID, v.security(), v.Type, v.TLS, v.Sni, v.Ps)
 }
 
 func (v Link) asNgLink() string {
@@ -71,21 +130,182 @@ func (v Link) asNgLink() string {
 	return "vmess://" + base64.StdEncoding.EncodeToString(b)
 }
 
+// quanMethod is the method written to quantumult links,
+// if the link security is not supported by quantumult
+const quanMethod = "aes-128-gcm"
+
+// quanMethods are the methods supported by quantumult, mapped from v2ray names
+var quanMethods = map[string]string{
+	"aes-128-gcm":       "aes-128-gcm",
+	"chacha20-poly1305": "chacha20-ietf-poly1305",
+	"none":              "none",
+}
+
+// quanScy returns the v2ray name of a quantumult method
+func quanScy(method string) string {
+	for scy, m := range quanMethods {
+		if m == method {
+			return scy
+		}
+	}
+	return method
+}
+
+// security returns the user security, which defaults to "auto"
+func (v Link) security() string {
+	if v.Scy == "" {
+		return "auto"
+	}
+	return v.Scy
+}
+
+// quanUserAgent is the User-Agent written to obfs-header of quantumult links
+const quanUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/16A5366a"
+
+// hasAid tells if the alterId is set and not 0
+func (v Link) hasAid() bool {
+	aid := fmt.Sprintf("%v", v.Aid)
+	return v.Aid != nil && aid != "0" && aid != ""
+}
+
+// LossyFields returns the fields of the link which can not be carried
+// by linkType format, in the form of "field=value". The linkType "json"
+// stands for the outbound of ToOutbound
+func (v Link) LossyFields(linkType string) []string {
+	lost := make([]string, 0)
+	aid := fmt.Sprintf("%v", v.Aid)
+	noComma := func(field, value string) {
+		if strings.Contains(value, ",") {
+			lost = append(lost, field+"="+value)
+		}
+	}
+	tlsExtra := func(sni bool) {
+		if !sni && v.Sni != "" {
+			lost = append(lost, "sni="+v.Sni)
+		}
+		if v.Alpn != "" {
+			lost = append(lost, "alpn="+v.Alpn)
+		}
+		if v.Fp != "" {
+			lost = append(lost, "fp="+v.Fp)
+		}
+	}
+	switch strings.ToLower(linkType) {
+	case "rk", "rocket", "shadowrocket":
+		tlsExtra(true)
+		switch v.Net {
+		case "", "tcp", "ws", "h2", "http":
+		case "kcp":
+			if v.Type != "" && v.Type != "none" {
+				lost = append(lost, "type="+v.Type)
+			}
+		default:
+			lost = append(lost, "net="+v.Net)
+		}
+	case "quan", "quantumult":
+		if _, ok := quanMethods[v.Scy]; !ok {
+			lost = append(lost, "scy="+v.security())
+		}
+		tlsExtra(false)
+		if v.hasAid() {
+			lost = append(lost, "aid="+aid)
+		}
+		switch v.Net {
+		case "", "tcp", "ws":
+		default:
+			lost = append(lost, "net="+v.Net)
+		}
+		noComma("host", v.Host)
+		noComma("path", v.Path)
+	case "quanx", "quantumultx":
+		if _, ok := quanMethods[v.Scy]; !ok {
+			lost = append(lost, "scy="+v.security())
+		}
+		tlsExtra(true)
+		if v.hasAid() {
+			lost = append(lost, "aid="+aid)
+		}
+		switch v.Net {
+		case "", "tcp", "ws":
+		default:
+			lost = append(lost, "net="+v.Net)
+		}
+		if v.Net != "ws" && v.Type == "http" && v.TLS == "tls" {
+			lost = append(lost, "tls="+v.TLS)
+		}
+		noComma("ps", v.Ps)
+		noComma("host", v.Host)
+		noComma("path", v.Path)
+	case "surge":
+		if v.security() != "auto" {
+			lost = append(lost, "scy="+v.Scy)
+		}
+		tlsExtra(true)
+		if v.hasAid() {
+			lost = append(lost, "aid="+aid)
+		}
+		switch v.Net {
+		case "ws":
+		case "", "tcp":
+			if v.Type != "" && v.Type != "none" {
+				lost = append(lost, "type="+v.Type)
+			}
+			if v.Path != "" {
+				lost = append(lost, "path="+v.Path)
+			}
+		default:
+			lost = append(lost, "net="+v.Net)
+		}
+		if v.Host != "" && v.Net != "ws" && v.TLS != "tls" {
+			lost = append(lost, "host="+v.Host)
+		}
+		if strings.Contains(v.Ps, "=") {
+			lost = append(lost, "ps="+v.Ps)
+		}
+		noComma("ps", v.Ps)
+		noComma("host", v.Host)
+		noComma("path", v.Path)
+	case "json":
+		// the core dials grpc in gun mode only
+		if v.Net == "grpc" && v.Type == "multi" {
+			lost = append(lost, "type="+v.Type)
+		}
+	}
+	return lost
+}
+
 func (v Link) asRocketLink() string {
-	mhp := fmt.Sprintf("%s:%s@%s:%s", v.Type, v.ID, v.Add, v.Port)
+	mhp := fmt.Sprintf("%s:%s@%s:%v", v.security(), v.ID, v.Add, v.Port)
 	qs := url.Values{}
 	qs.Add("remarks", v.Ps)
-	if v.Net == "ws" {
+	switch v.Net {
+	case "ws":
 		qs.Add("obfs", "websocket")
+	case "h2", "http":
+		qs.Add("obfs", "h2")
+	case "kcp":
+		qs.Add("obfs", "mkcp")
+	default:
+		if v.Type == "http" {
+			qs.Add("obfs", "http")
+		} else {
+			qs.Add("obfs", "none")
+		}
 	}
 	if v.Host != "" {
 		qs.Add("obfsParam", v.Host)
 	}
 	if v.Path != "" {
-		qs.Add("path", v.Host)
+		qs.Add("path", v.Path)
 	}
 	if v.TLS == "tls" {
 		qs.Add("tls", "1")
+		if v.Sni != "" {
+			qs.Add("peer", v.Sni)
+		}
+	}
+	if v.hasAid() {
+		qs.Add("alterId", fmt.Sprintf("%v", v.Aid))
 	}
 
 	url := url.URL{
@@ -104,22 +324,30 @@ func (v Link) asQuantumult() string {
 	   let quanVmess  = `${jsonConf.ps} = vmess,${jsonConf.add},${jsonConf.port},${method},"${jsonConf.id}",over-tls=${jsonConf.tls === 'tls' ? 'true' : 'false'},certificate=1${jsonConf.type === 'none' && jsonConf.net !== 'ws' ? '' : obfs},group=${group}`
 	*/
 
-	method := "aes-128-gcm"
-	vbase := fmt.Sprintf("%s = vmess,%s,%s,%s,\"%s\",over-tls=%v,certificate=1", v.Ps, v.Add, v.Port, method, v.ID, v.TLS == "tls")
-
-	var obfs string
-	if (v.Net == "ws" || v.Net == "http") && (v.Type == "none" || v.Type == "") {
-		if v.Path == "" {
-			v.Path = "/"
+	method, ok := quanMethods[v.Scy]
+	if !ok {
+		method = quanMethod
+	}
+	vbase := fmt.Sprintf("%s = vmess,%s,%v,%s,\"%s\",over-tls=%v,certificate=1", v.Ps, v.Add, v.Port, method, v.ID, v.TLS == "tls")
+
+	obfs := ""
+	switch {
+	case v.Net == "ws":
+		obfs = "ws"
+	case (v.Net == "" || v.Net == "tcp") && v.Type == "http":
+		obfs = "http"
+	}
+	if obfs != "" {
+		vbase += ",obfs=" + obfs
+		if v.Path != "" {
+			vbase += fmt.Sprintf(`,obfs-path="%s"`, v.Path)
 		}
-		if v.Host == "" {
-			v.Host = v.Add
+		host := v.Host
+		if host == "" {
+			host = v.Add
 		}
-		obfs = fmt.Sprintf(`,obfs=ws,obfs-path="%s",obfs-header="Host:%s[Rr][Nn]User-Agent:Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/16A5366a"`, v.Path, v.Host)
+		vbase += fmt.Sprintf(`,obfs-header="Host:%s[Rr][Nn]User-Agent:%s"`, host, quanUserAgent)
 	}
-
-	vbase += obfs
-	vbase += ",group=Fndroid"
 	return "vmess://" + base64.URLEncoding.EncodeToString([]byte(vbase))
 }
 
@@ -146,45 +374,52 @@ func NewQuanVmess(vmess string) (*Link, error) {
 	}
 	v.Ps = psn[0]
 	params := strings.Split(psn[1], ",")
+	for i := range params {
+		params[i] = strings.TrimSpace(params[i])
+	}
+	if len(params) < 5 || params[0] != "vmess" {
+		return nil, fmt.Errorf("part error: %s", info)
+	}
 	v.Add = params[1]
 	v.Port = params[2]
 	v.ID = strings.Trim(params[4], "\"")
+	v.Scy = quanScy(params[3])
 	v.Aid = "0"
 	v.Net = "tcp"
 	v.Type = "none"
 
-	if len(params) > 4 {
-		for _, pkv := range params[5:] {
-			kvp := strings.SplitN(pkv, "=", 2)
-			if kvp[0] == "over-tls" && kvp[1] == "true" {
-				v.TLS = "tls"
-			}
+	for _, pkv := range params[5:] {
+		kvp := strings.SplitN(pkv, "=", 2)
+		if len(kvp) != 2 {
+			continue
+		}
+		if kvp[0] == "over-tls" && kvp[1] == "true" {
+			v.TLS = "tls"
+		}
 
-			if kvp[0] == "obfs" && kvp[1] == "ws" {
-				v.Net = "ws"
-			}
+		if kvp[0] == "obfs" && kvp[1] == "ws" {
+			v.Net = "ws"
+		}
 
-			if kvp[0] == "obfs" && kvp[1] == "http" {
-				v.Type = "http"
-			}
+		if kvp[0] == "obfs" && kvp[1] == "http" {
+			v.Type = "http"
+		}
 
-			if kvp[0] == "obfs-path" {
-				v.Path = strings.Trim(kvp[1], "\"")
-			}
+		if kvp[0] == "obfs-path" {
+			v.Path = strings.Trim(kvp[1], "\"")
+		}
 
-			if kvp[0] == "obfs-header" {
-				hd := strings.Trim(kvp[1], "\"")
-				for _, hl := range strings.Split(hd, "[Rr][Nn]") {
-					if strings.HasPrefix(hl, "Host:") {
-						host := hl[5:]
-						if host != v.Add {
-							v.Host = host
-						}
-						break
+		if kvp[0] == "obfs-header" {
+			hd := strings.Trim(kvp[1], "\"")
+			for _, hl := range strings.Split(hd, "[Rr][Nn]") {
+				if strings.HasPrefix(hl, "Host:") {
+					host := strings.TrimSpace(hl[5:])
+					if host != v.Add {
+						v.Host = host
 					}
+					break
 				}
 			}
-
 		}
 	}
 
@@ -208,6 +443,9 @@ func NewVnVmess(vmess string) (*Link, error) {
 	if err := json.Unmarshal(b, v); err != nil {
 		return nil, err
 	}
+	if v.Add == "" || v.ID == "" {
+		return nil, fmt.Errorf("vmess unreconized: no add or id -- %s", vmess)
+	}
 	v.OrigLink = vmess
 
 	return v, nil
@@ -233,10 +471,10 @@ func NewRkVmess(vmess string) (*Link, error) {
 	}
 
 	mhp := strings.SplitN(string(b), ":", 3)
-	if len(mhp) != 3 {
+	if len(mhp) != 3 || strings.ContainsAny(mhp[0], " ,=") {
 		return nil, fmt.Errorf("vmess unreconized: method:host:port -- %v", mhp)
 	}
-	// mhp[0] is the encryption method
+	link.Scy = mhp[0]
 	link.Port = mhp[2]
 	idadd := strings.SplitN(mhp[1], "@", 2)
 	if len(idadd) != 2 {
@@ -245,6 +483,8 @@ func NewRkVmess(vmess string) (*Link, error) {
 	link.ID = idadd[0]
 	link.Add = idadd[1]
 	link.Aid = "0"
+	link.Net = "tcp"
+	link.Type = "none"
 
 	vals := url.Query()
 	if v := vals.Get("remarks"); v != "" {
@@ -260,14 +500,23 @@ func NewRkVmess(vmess string) (*Link, error) {
 		switch v {
 		case "websocket":
 			link.Net = "ws"
-		case "none":
-			link.Net = "tcp"
-			link.Type = "none"
+		case "h2":
+			link.Net = "h2"
+		case "mkcp":
+			link.Net = "kcp"
+		case "http":
+			link.Type = "http"
 		}
 	}
 	if v := vals.Get("obfsParam"); v != "" {
 		link.Host = v
 	}
+	if v := vals.Get("peer"); v != "" {
+		link.Sni = v
+	}
+	if v := vals.Get("alterId"); v != "" {
+		link.Aid = v
+	}
 
 	return link, nil
 }
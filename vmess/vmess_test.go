@@ -1,6 +1,9 @@
 package vmess
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -22,19 +25,33 @@ func TestNewQuanVmess(t *testing.T) {
 		want    *Link
 		wantErr bool
 	}{
-		// TODO: Add test cases.
 		{
-			"1",
-			"vmess://",
-			Must(NewVnVmess("")).(*Link),
+			"ws",
+			// node = vmess,example.com,443,aes-128-gcm,"27b8a625-4f4b-4428-9f0f-8a2317db7c79",over-tls=true,certificate=1,obfs=ws,obfs-path="/ws",obfs-header="Host:cdn.example.com[Rr][Nn]User-Agent:Mozilla/5.0",group=Fndroid
+			"vmess://bm9kZSA9IHZtZXNzLGV4YW1wbGUuY29tLDQ0MyxhZXMtMTI4LWdjbSwiMjdiOGE2MjUtNGY0Yi00NDI4LTlmMGYtOGEyMzE3ZGI3Yzc5IixvdmVyLXRscz10cnVlLGNlcnRpZmljYXRlPTEsb2Jmcz13cyxvYmZzLXBhdGg9Ii93cyIsb2Jmcy1oZWFkZXI9Ikhvc3Q6Y2RuLmV4YW1wbGUuY29tW1JyXVtObl1Vc2VyLUFnZW50Ok1vemlsbGEvNS4wIixncm91cD1GbmRyb2lk",
+			Must(NewVnVmess("vmess://eyJ2IjoiMiIsImFkZCI6ImV4YW1wbGUuY29tIiwicG9ydCI6IjQ0MyIsImlkIjoiMjdiOGE2MjUtNGY0Yi00NDI4LTlmMGYtOGEyMzE3ZGI3Yzc5IiwibmV0Ijoid3MiLCJ0eXBlIjoibm9uZSIsImhvc3QiOiJjZG4uZXhhbXBsZS5jb20iLCJwYXRoIjoiL3dzIiwidGxzIjoidGxzIiwicHMiOiJub2RlIn0=")).(*Link),
 			false,
 		},
 		{
-			"2",
-			"",
-			Must(NewVnVmess("")).(*Link),
+			"ws spaces",
+			// node = vmess, example.com, 443, aes-128-gcm, "27b8a625-4f4b-4428-9f0f-8a2317db7c79", over-tls=true, certificate=1, obfs=ws, obfs-path="/ws", obfs-header="Host: cdn.example.com[Rr][Nn]User-Agent: Mozilla/5.0", group=Fndroid
+			"vmess://bm9kZSA9IHZtZXNzLCBleGFtcGxlLmNvbSwgNDQzLCBhZXMtMTI4LWdjbSwgIjI3YjhhNjI1LTRmNGItNDQyOC05ZjBmLThhMjMxN2RiN2M3OSIsIG92ZXItdGxzPXRydWUsIGNlcnRpZmljYXRlPTEsIG9iZnM9d3MsIG9iZnMtcGF0aD0iL3dzIiwgb2Jmcy1oZWFkZXI9Ikhvc3Q6IGNkbi5leGFtcGxlLmNvbVtScl1bTm5dVXNlci1BZ2VudDogTW96aWxsYS81LjAiLCBncm91cD1GbmRyb2lk",
+			Must(NewVnVmess("vmess://eyJ2IjoiMiIsImFkZCI6ImV4YW1wbGUuY29tIiwicG9ydCI6IjQ0MyIsImlkIjoiMjdiOGE2MjUtNGY0Yi00NDI4LTlmMGYtOGEyMzE3ZGI3Yzc5IiwibmV0Ijoid3MiLCJ0eXBlIjoibm9uZSIsImhvc3QiOiJjZG4uZXhhbXBsZS5jb20iLCJwYXRoIjoiL3dzIiwidGxzIjoidGxzIiwicHMiOiJub2RlIn0=")).(*Link),
 			false,
 		},
+		{
+			"short",
+			// node = vmess,example.com
+			"vmess://bm9kZSA9IHZtZXNzLGV4YW1wbGUuY29t",
+			nil,
+			true,
+		},
+		{
+			"empty",
+			"",
+			nil,
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -43,7 +60,11 @@ func TestNewQuanVmess(t *testing.T) {
 				t.Errorf("NewQuanVmess() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.wantErr {
+				return
+			}
 			tt.want.Aid = "0"
+			tt.want.Scy = "aes-128-gcm"
 			tt.want.OrigLink = got.OrigLink
 
 			if d := cmp.Diff(got, tt.want); d != "" {
@@ -53,11 +74,199 @@ func TestNewQuanVmess(t *testing.T) {
 	}
 }
 
+func TestNewQuanXVmess(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		scy  string
+	}{
+		{"chacha20", "vmess=example.com:443, method=chacha20-ietf-poly1305, password=27b8a625-4f4b-4428-9f0f-8a2317db7c79, obfs=wss, tag=node", "chacha20-poly1305"},
+		{"aes", "vmess=example.com:443, method=aes-128-gcm, password=27b8a625-4f4b-4428-9f0f-8a2317db7c79, tag=node", "aes-128-gcm"},
+		{"none", "vmess=example.com:443, method=none, password=27b8a625-4f4b-4428-9f0f-8a2317db7c79, tag=node", "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewQuanXVmess(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Scy != tt.scy {
+				t.Errorf("got scy %s, want %s", got.Scy, tt.scy)
+			}
+			if errs := got.Validate(); errs != nil {
+				t.Error(errs)
+			}
+		})
+	}
+}
+
 func TestParseVmess(t *testing.T) {
-	vm, err := ParseVmess("")
+	// {"v":"2","add":"example.com","port":443,"id":"27b8a625-4f4b-4428-9f0f-8a2317db7c79","aid":4,"net":"h2","host":"h2.example.com","path":"/h2","tls":"tls","ps":"node"}
+	vm, err := ParseVmess("vmess://eyJ2IjoiMiIsImFkZCI6ImV4YW1wbGUuY29tIiwicG9ydCI6NDQzLCJpZCI6IjI3YjhhNjI1LTRmNGItNDQyOC05ZjBmLThhMjMxN2RiN2M3OSIsImFpZCI6NCwibmV0IjoiaDIiLCJob3N0IjoiaDIuZXhhbXBsZS5jb20iLCJwYXRoIjoiL2gyIiwidGxzIjoidGxzIiwicHMiOiJub2RlIn0=")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	t.Log(vm.LinkStr("ng"))
 	t.Logf("%#v", vm)
+	if host, port := vm.Server(); host != "example.com" || port != "443" {
+		t.Errorf("got server %s:%s", host, port)
+	}
+	if _, err := ParseVmess("vmess://not a link"); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestLinkIsEqual(t *testing.T) {
+	base := func(l *Link) *Link {
+		l.Add, l.ID = "example.com", "27b8a625-4f4b-4428-9f0f-8a2317db7c79"
+		return l
+	}
+	tests := []struct {
+		name string
+		a, b *Link
+		want bool
+	}{
+		{"port types", base(&Link{Port: "443", Aid: "4"}), base(&Link{Port: float64(443), Aid: 4}), true},
+		{"json number", base(&Link{Port: json.Number("443"), Aid: ""}), base(&Link{Port: 443, Aid: float64(0)}), true},
+		{"defaults", base(&Link{Port: 443, Net: "tcp", Type: "none", TLS: "none", Scy: "auto"}), base(&Link{Port: 443}), true},
+		{"remarks", base(&Link{Port: 443, Ps: "a"}), base(&Link{Port: 443, Ps: "b"}), true},
+		{"port", base(&Link{Port: "443"}), base(&Link{Port: 8443}), false},
+		{"aid", base(&Link{Port: 443, Aid: "0"}), base(&Link{Port: 443, Aid: 4}), false},
+		{"scy", base(&Link{Port: 443, Scy: "none"}), base(&Link{Port: 443}), false},
+		{"tls", base(&Link{Port: 443, TLS: "tls"}), base(&Link{Port: 443}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.IsEqual(tt.b); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := tt.b.IsEqual(tt.a); got != tt.want {
+				t.Errorf("reversed: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkRoundTrip(t *testing.T) {
+	base := func(l *Link) *Link {
+		l.Ver, l.Add, l.Port, l.ID, l.Ps = "2", "example.com", "443", "27b8a625-4f4b-4428-9f0f-8a2317db7c79", "node 1"
+		if l.Aid == nil {
+			l.Aid = "0"
+		}
+		if l.Type == "" {
+			l.Type = "none"
+		}
+		if l.Scy == "" {
+			l.Scy = "aes-128-gcm"
+		}
+		return l
+	}
+	tests := []struct {
+		name string
+		link *Link
+		// lossy fields by format
+		lost map[string][]string
+		// written is the text expected in the link of format
+		written map[string]string
+	}{
+		{
+			"tcp", base(&Link{Net: "tcp"}),
+			map[string][]string{"surge": {"scy=aes-128-gcm"}},
+			nil,
+		},
+		{
+			"tcp http",
+			base(&Link{Net: "tcp", Type: "http", Host: "a.example.com", Path: "/a"}),
+			map[string][]string{"surge": {"scy=aes-128-gcm", "type=http", "path=/a", "host=a.example.com"}},
+			nil,
+		},
+		{
+			"ws tls",
+			base(&Link{Net: "ws", Host: "cdn.example.com", Path: "/ws?ed=2048", TLS: "tls", Scy: "chacha20-poly1305"}),
+			map[string][]string{"surge": {"scy=chacha20-poly1305"}},
+			map[string]string{"quan": ",chacha20-ietf-poly1305,", "quanx": "method=chacha20-ietf-poly1305"},
+		},
+		{
+			"ws aid",
+			base(&Link{Net: "ws", Aid: "64", Path: "/ws"}),
+			map[string][]string{"quan": {"aid=64"}, "quanx": {"aid=64"}, "surge": {"scy=aes-128-gcm", "aid=64"}},
+			nil,
+		},
+		{
+			"h2 tls",
+			base(&Link{Net: "h2", Host: "h2.example.com", Path: "/h2", TLS: "tls"}),
+			map[string][]string{"quan": {"net=h2"}, "quanx": {"net=h2"}, "surge": {"scy=aes-128-gcm", "net=h2"}},
+			nil,
+		},
+		{
+			"kcp",
+			base(&Link{Net: "kcp", Type: "wechat-video"}),
+			map[string][]string{"rk": {"type=wechat-video"}, "quan": {"net=kcp"}, "quanx": {"net=kcp"}, "surge": {"scy=aes-128-gcm", "net=kcp"}},
+			nil,
+		},
+		{
+			"auto sni",
+			base(&Link{Net: "ws", Host: "cdn.example.com", TLS: "tls", Sni: "sni.example.com", Scy: "auto"}),
+			map[string][]string{"quan": {"scy=auto", "sni=sni.example.com"}, "quanx": {"scy=auto"}},
+			nil,
+		},
+		{
+			"alpn fp",
+			base(&Link{Net: "tcp", TLS: "tls", Alpn: "h2,http/1.1", Fp: "chrome"}),
+			map[string][]string{
+				"rk":    {"alpn=h2,http/1.1", "fp=chrome"},
+				"quan":  {"alpn=h2,http/1.1", "fp=chrome"},
+				"quanx": {"alpn=h2,http/1.1", "fp=chrome"},
+				"surge": {"scy=aes-128-gcm", "alpn=h2,http/1.1", "fp=chrome"},
+			},
+			nil,
+		},
+	}
+	parse := func(s string) (*Link, error) {
+		lk, err := ParseLink(s)
+		if err != nil {
+			return nil, err
+		}
+		l := lk.(*Link)
+		l.OrigLink = ""
+		return l, nil
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"ng", "rk", "quan", "quanx", "surge"} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				lost := tt.link.LossyFields(format)
+				if len(lost) > 0 || len(tt.lost[format]) > 0 {
+					if d := cmp.Diff(tt.lost[format], lost); d != "" {
+						t.Errorf("lossy fields: %s", d)
+					}
+					return
+				}
+				s := tt.link.LinkStr(format)
+				if want, ok := tt.written[format]; ok {
+					text := s
+					if format == "quan" {
+						b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "vmess://"))
+						text = string(b)
+					}
+					if !strings.Contains(text, want) {
+						t.Errorf("%s should contain %s", text, want)
+					}
+				}
+				got, err := parse(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := cmp.Diff(tt.link, got); d != "" {
+					t.Errorf("%s\n%s", s, d)
+				}
+				again, err := parse(got.LinkStr(format))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := cmp.Diff(got, again); d != "" {
+					t.Error(d)
+				}
+			})
+		}
+	}
 }
@@ -0,0 +1,224 @@
+package vmessping
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/qjebbs/v2tool/files"
+	mv2ray "github.com/qjebbs/v2tool/miniv2ray"
+	"github.com/qjebbs/v2tool/vmess"
+	"github.com/v2fly/v2ray-core/v5"
+)
+
+// Node is a target of batch ping
+type Node struct {
+	// Name is the display name of the node
+	Name string
+	// Vmess is a share link, a json config, or the path of a json config file
+	Vmess string
+}
+
+// BatchResult is the ping result of a node
+type BatchResult struct {
+	Node *Node
+	Stat *PingStat
+	Err  error
+}
+
+// LoadNodes resolves ping targets from sources, a source could be a share link,
+// a subscription URL, a json file, a folder contains json files, or a file of links
+func LoadNodes(sources []string) ([]*Node, error) {
+	nodes := make([]*Node, 0)
+	for _, src := range sources {
+		if vmess.IsSupportedLink(src) {
+			lk, err := vmess.ParseLink(src)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, &Node{Name: lk.Remarks(), Vmess: src})
+			continue
+		}
+		if u, err := url.Parse(src); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+			switch u.Scheme {
+			case "http", "https":
+				links, err := vmess.LinksFromSubscription(src)
+				if err != nil {
+					return nil, err
+				}
+				for _, lk := range links {
+					nodes = append(nodes, &Node{Name: lk.Remarks(), Vmess: lk.ShareLink()})
+				}
+			default:
+				lk, err := vmess.ParseLink(src)
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, &Node{Name: lk.Remarks(), Vmess: src})
+			}
+			continue
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		ext := filepath.Ext(src)
+		if info.IsDir() || ext == ".json" || ext == ".jsonc" {
+			fs, err := files.PathsToFiles([]string{src})
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fs {
+				nodes = append(nodes, &Node{Name: strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)), Vmess: f})
+			}
+			continue
+		}
+		ns, err := nodesFromLinkFile(src)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, ns...)
+	}
+	return nodes, nil
+}
+
+func nodesFromLinkFile(file string) ([]*Node, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nodes := make([]*Node, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !vmess.IsSupportedLink(line) {
+			continue
+		}
+		lk, err := vmess.ParseLink(line)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, &Node{Name: lk.Remarks(), Vmess: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// PingMany pings nodes concurrently, with at most "workers" nodes being probed at the same time.
+// All nodes are carried by one core instance. There's one result for each node, in the same
+// order of nodes, nodes not pinged before ctx is done have the error of it.
+// If setup is not nil, it's called with the pinger of each node before it runs, to install hooks.
+func PingMany(ctx context.Context, nodes []*Node, workers uint, opts *Options, setup func(p *Pinger)) ([]*BatchResult, error) {
+	if workers == 0 {
+		workers = 1
+	}
+	opts = opts.withDefaults()
+	results := make([]*BatchResult, len(nodes))
+	obs := make([]*core.OutboundHandlerConfig, 0, len(nodes))
+	tags := make([]string, len(nodes))
+	for i, node := range nodes {
+		results[i] = &BatchResult{Node: node}
+		ob, err := mv2ray.Outbound(node.Vmess, opts.UseMux)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		tags[i] = fmt.Sprintf("node-%d", i)
+		ob.Tag = tags[i]
+		obs = append(obs, ob)
+	}
+	if len(obs) == 0 {
+		return results, nil
+	}
+	server, err := mv2ray.StartOutbounds(obs, opts.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	defer server.Close()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := uint(0); w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				p := &Pinger{
+					Vmess:   nodes[i].Vmess,
+					Node:    newNodeInfo(nodes[i].Name, nodes[i].Vmess),
+					Options: opts,
+				}
+				if setup != nil {
+					setup(p)
+				}
+				results[i].Stat = p.run(ctx, server, tags[i], opts)
+			}
+		}()
+	}
+L:
+	for i := range nodes {
+		if results[i].Err != nil {
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break L
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Stat == nil && r.Err == nil {
+			r.Err = fmt.Errorf("not pinged: %v", ctx.Err())
+		}
+	}
+	return results, nil
+}
+
+// SortResults ranks results by loss and then by average delay,
+// nodes failed to start are put at the end
+func SortResults(results []*BatchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Stat == nil || b.Stat == nil {
+			return a.Stat != nil
+		}
+		if a.Stat.LossPercent != b.Stat.LossPercent {
+			return a.Stat.LossPercent < b.Stat.LossPercent
+		}
+		return a.Stat.AvgMs < b.Stat.AvgMs
+	})
+}
+
+// WriteBatchStats writes the ranked table of batch results to out
+func WriteBatchStats(out io.Writer, results []*BatchResult) {
+	SortResults(results)
+	fmt.Fprintln(out, "\n--- vmess ping batch statistics ---")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tLOSS\tMIN\tAVG\tMAX\tP90\tMDEV\tJITTER\tNODE")
+	for i, r := range results {
+		if r.Stat == nil {
+			fmt.Fprintf(w, "%d\t-\t-\t-\t-\t-\t-\t-\t%s (%v)\n", i+1, r.Node.Name, r.Err)
+			continue
+		}
+		s := r.Stat
+		fmt.Fprintf(w, "%d\t%.1f%%\t%d\t%d\t%d\t%d\t%.1f\t%.1f\t%s\n", i+1, s.LossPercent, s.MinMs, s.AvgMs, s.MaxMs, s.P90Ms, s.MdevMs, s.JitterMs, r.Node.Name)
+	}
+	w.Flush()
+}
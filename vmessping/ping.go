@@ -1,11 +1,16 @@
 package vmessping
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"sort"
 	"time"
 
 	mv2ray "github.com/qjebbs/v2tool/miniv2ray"
+	"github.com/v2fly/v2ray-core/v5"
 )
 
 func PrintVersion(mv string) {
@@ -13,112 +18,297 @@ func PrintVersion(mv string) {
 		"Vmessping ver[%s], A prober for v2ray (v2ray-core: %s)\n", mv, mv2ray.CoreVersion())
 }
 
+// PingStat is the statistics of a ping, field names in json are stable
 type PingStat struct {
-	StartTime  time.Time
-	SumMs      uint
-	MaxMs      uint
-	MinMs      uint
-	AvgMs      uint
-	Delays     []int64
-	ReqCounter uint
-	ErrCounter uint
+	StartTime  time.Time `json:"start_time"`
+	SumMs      uint      `json:"sum_ms"`
+	MaxMs      uint      `json:"max_ms"`
+	MinMs      uint      `json:"min_ms"`
+	AvgMs      uint      `json:"avg_ms"`
+	Delays     []int64   `json:"delays_ms"`
+	ReqCounter uint      `json:"requests"`
+	ErrCounter uint      `json:"errors"`
+	// LossPercent is the percentage of failed requests
+	LossPercent float64 `json:"loss_percent"`
+	MedianMs    uint    `json:"median_ms"`
+	P90Ms       uint    `json:"p90_ms"`
+	P95Ms       uint    `json:"p95_ms"`
+	P99Ms       uint    `json:"p99_ms"`
+	// MdevMs is the standard deviation of delays, like the mdev of ping
+	MdevMs float64 `json:"mdev_ms"`
+	// JitterMs is the mean difference between consecutive delays
+	JitterMs float64 `json:"jitter_ms"`
 }
 
 func (p *PingStat) CalStats() {
-	for _, v := range p.Delays {
-		p.SumMs += uint(v)
-		if p.MaxMs == 0 || p.MinMs == 0 {
-			p.MaxMs = uint(v)
-			p.MinMs = uint(v)
+	p.SumMs = 0
+	var sumSq float64
+	for i, v := range p.Delays {
+		uv := uint(v)
+		p.SumMs += uv
+		sumSq += float64(v) * float64(v)
+		if i == 0 {
+			p.MaxMs = uv
+			p.MinMs = uv
 		}
-		if uv := uint(v); uv > p.MaxMs {
+		if uv > p.MaxMs {
 			p.MaxMs = uv
 		}
-		if uv := uint(v); uv < p.MinMs {
+		if uv < p.MinMs {
 			p.MinMs = uv
 		}
+		if i > 0 {
+			p.JitterMs += math.Abs(float64(v - p.Delays[i-1]))
+		}
+	}
+	if n := len(p.Delays); n > 0 {
+		mean := float64(p.SumMs) / float64(n)
+		p.AvgMs = uint(mean)
+		p.MdevMs = math.Sqrt(math.Max(sumSq/float64(n)-mean*mean, 0))
+		if n > 1 {
+			p.JitterMs /= float64(n - 1)
+		}
+		sorted := make([]int64, n)
+		copy(sorted, p.Delays)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		p.MedianMs = percentile(sorted, 50)
+		p.P90Ms = percentile(sorted, 90)
+		p.P95Ms = percentile(sorted, 95)
+		p.P99Ms = percentile(sorted, 99)
+	}
+	if p.ReqCounter > 0 {
+		p.LossPercent = float64(p.ReqCounter-uint(len(p.Delays))) / float64(p.ReqCounter) * 100
 	}
-	if len(p.Delays) > 0 {
-		p.AvgMs = uint(float64(p.SumMs) / float64(len(p.Delays)))
+}
+
+// percentile returns the nearest-rank percentile of sorted delays
+func percentile(sorted []int64, n float64) uint {
+	rank := int(math.Ceil(n / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
 	}
+	return uint(sorted[rank-1])
 }
 
 func (p PingStat) PrintStats() {
-	fmt.Println("\n--- vmess ping statistics ---")
-	fmt.Printf("%d requests made, %d success, total time %v\n", p.ReqCounter, len(p.Delays), time.Since(p.StartTime))
-	fmt.Printf("rtt min/avg/max = %d/%d/%d ms\n", p.MinMs, p.AvgMs, p.MaxMs)
+	p.writeStats(os.Stdout)
+}
+
+func (p PingStat) writeStats(w io.Writer) {
+	fmt.Fprintln(w, "\n--- vmess ping statistics ---")
+	fmt.Fprintf(w, "%d requests made, %d success, %.1f%% loss, total time %v\n", p.ReqCounter, len(p.Delays), p.LossPercent, time.Since(p.StartTime))
+	fmt.Fprintf(w, "rtt min/avg/max/mdev = %d/%d/%d/%.1f ms\n", p.MinMs, p.AvgMs, p.MaxMs, p.MdevMs)
+	fmt.Fprintf(w, "rtt median/p90/p95/p99 = %d/%d/%d/%d ms, jitter = %.1f ms\n", p.MedianMs, p.P90Ms, p.P95Ms, p.P99Ms, p.JitterMs)
 }
 
 func (p PingStat) IsErr() bool {
 	return len(p.Delays) == 0
 }
 
-func Ping(vmess string, count uint, dest string, timeoutsec, inteval, quit uint, stopCh <-chan os.Signal, showNode, verbose, usemux bool) (*PingStat, error) {
-	server, err := mv2ray.StartV2Ray(vmess, verbose, usemux)
+// Options are the options of a Pinger, a nil Options is taken as the defaults
+type Options struct {
+	// Count stops the ping after sending Count requests, defaults to 3
+	Count uint
+	// Dest is the test destination url, defaults to http://www.google.com/gen_204
+	Dest string
+	// Timeout is the timeout of each request, defaults to 10 seconds
+	Timeout time.Duration
+	// Interval is the interval between requests
+	Interval time.Duration
+	// Quit stops the ping when error counts reach it, 0 for never
+	Quit uint
+	// ShowNode resolves the location and outbound ip of the node
+	ShowNode bool
+	// Verbose enables debug log of the core
+	Verbose bool
+	// UseMux enables mux of the outbound
+	UseMux bool
+}
+
+// withDefaults returns a copy of o, with the defaults of zero fields
+func (o *Options) withDefaults() *Options {
+	opts := &Options{}
+	if o != nil {
+		*opts = *o
+	}
+	if opts.Count == 0 {
+		opts.Count = 3
+	}
+	if opts.Dest == "" {
+		opts.Dest = "http://www.google.com/gen_204"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return opts
+}
+
+// Pinger pings a node, the hooks are called during the ping if not nil
+type Pinger struct {
+	// Vmess is a share link, a json config, or the path of a json config file
+	Vmess   string
+	Node    *NodeInfo
+	Options *Options
+
+	// OnNode is called when the node is ready to ping
+	OnNode func(node *NodeInfo)
+	// OnLocated is called when the location of the node is resolved
+	OnLocated func(node *NodeInfo)
+	// OnResult is called after each request
+	OnResult func(seq uint, delay int64, err error)
+	// OnFinish is called with the statistics when the ping finishes
+	OnFinish func(stat *PingStat)
+}
+
+// NewPinger creates a pinger for vmess, which is a share link or the path of a json outbound file
+func NewPinger(vmess string, opts *Options) *Pinger {
+	return &Pinger{
+		Vmess:   vmess,
+		Node:    newNodeInfo("", vmess),
+		Options: opts,
+	}
+}
+
+// Run starts a core for the node and pings until the count is reached
+// or ctx is done
+func (p *Pinger) Run(ctx context.Context) (*PingStat, error) {
+	opts := p.Options.withDefaults()
+	ob, err := mv2ray.Outbound(p.Vmess, opts.UseMux)
+	if err != nil {
+		return nil, err
+	}
+	server, err := mv2ray.StartOutbound(ob, opts.Verbose)
 	if err != nil {
-		fmt.Println(err.Error())
 		return nil, err
 	}
 
 	if err := server.Start(); err != nil {
-		fmt.Println("Failed to start", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to start: %v", err)
 	}
 	defer server.Close()
 
-	if showNode {
+	return p.run(ctx, server, "", opts), nil
+}
+
+// Ping pings dest through the node of vmess, which could be a vmess link
+// or a json file, and prints the results until count is reached or stopCh
+// receives. The statistics are returned, but not printed
+//
+// Deprecated: use NewPinger and Run, which take a context, hooks and the
+// output formats.
+func Ping(vmess string, count uint, dest string, timeoutsec, inteval, quit uint, stopCh <-chan os.Signal, showNode, verbose, usemux bool) (*PingStat, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	p := NewPinger(vmess, &Options{
+		Count:    count,
+		Dest:     dest,
+		Timeout:  time.Second * time.Duration(timeoutsec),
+		Interval: time.Second * time.Duration(inteval),
+		Quit:     quit,
+		ShowNode: showNode,
+		Verbose:  verbose,
+		UseMux:   usemux,
+	})
+	Attach(p, &textReporter{w: os.Stdout, dest: dest})
+	// callers print the statistics themselves
+	p.OnFinish = nil
+	ps, err := p.Run(ctx)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+	return ps, nil
+}
+
+type probeResult struct {
+	delay int64
+	err   error
+}
+
+// run pings through the outbound of tag in a started core instance
+func (p *Pinger) run(ctx context.Context, server *core.Instance, tag string, opts *Options) *PingStat {
+	if p.OnNode != nil {
+		p.OnNode(p.Node)
+	}
+
+	// the location is resolved in background, and reported
+	// between requests, so that hooks are never called concurrently
+	var chInfo chan map[string]string
+	if opts.ShowNode {
+		chInfo = make(chan map[string]string, 1)
 		go func() {
-			info, err := mv2ray.GetNodeInfo(server, time.Second*10)
+			info, err := mv2ray.GetNodeInfoTag(server, tag, time.Second*10)
 			if err != nil {
 				return
 			}
-
-			fmt.Printf("Node Outbound: %s/%s\n", info["loc"], info["ip"])
+			chInfo <- info
 		}()
 	}
+	checkLocated := func() {
+		select {
+		case info := <-chInfo:
+			p.Node.Location, p.Node.IP = info["loc"], info["ip"]
+			if p.OnLocated != nil {
+				p.OnLocated(p.Node)
+			}
+		default:
+		}
+	}
 
 	ps := &PingStat{}
 	ps.StartTime = time.Now()
-	round := count
+	round := opts.Count
 L:
 	for round > 0 {
-		seq := count - round + 1
+		checkLocated()
+		seq := opts.Count - round + 1
 		ps.ReqCounter++
 
-		chDelay := make(chan int64)
+		chResult := make(chan probeResult, 1)
 		go func() {
-			delay, err := mv2ray.MeasureDelay(server, time.Second*time.Duration(timeoutsec), dest)
-			if err != nil {
-				ps.ErrCounter++
-				fmt.Printf("Ping %s: seq=%d err %v\n", dest, seq, err)
-			}
-			chDelay <- delay
+			delay, err := mv2ray.MeasureDelayTag(server, tag, opts.Timeout, opts.Dest)
+			chResult <- probeResult{delay, err}
 		}()
 
 		select {
-		case delay := <-chDelay:
-			if delay > 0 {
-				ps.Delays = append(ps.Delays, delay)
-				fmt.Printf("Ping %s: seq=%d time=%d ms\n", dest, seq, delay)
+		case r := <-chResult:
+			if r.err != nil {
+				ps.ErrCounter++
+			} else {
+				ps.Delays = append(ps.Delays, r.delay)
 			}
-		case <-stopCh:
+			if p.OnResult != nil {
+				p.OnResult(seq, r.delay, r.err)
+			}
+		case <-ctx.Done():
 			break L
 		}
 
-		if quit > 0 && ps.ErrCounter >= quit {
+		if opts.Quit > 0 && ps.ErrCounter >= opts.Quit {
 			break
 		}
 
 		if round--; round > 0 {
 			select {
-			case <-time.After(time.Second * time.Duration(inteval)):
+			case <-time.After(opts.Interval):
 				continue
-			case <-stopCh:
+			case <-ctx.Done():
 				break L
 			}
 		}
 	}
 
+	checkLocated()
 	ps.CalStats()
-	return ps, nil
+	if p.OnFinish != nil {
+		p.OnFinish(ps)
+	}
+	return ps
 }
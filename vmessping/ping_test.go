@@ -0,0 +1,192 @@
+package vmessping
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCalStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		stat   *PingStat
+		min    uint
+		avg    uint
+		max    uint
+		median uint
+		p90    uint
+		mdev   float64
+		jitter float64
+		loss   float64
+	}{
+		{
+			"zero delay",
+			&PingStat{Delays: []int64{0, 10, 20}, ReqCounter: 3},
+			0, 10, 20, 10, 20, 8.16, 10, 0,
+		},
+		{
+			"with loss",
+			&PingStat{Delays: []int64{100, 300, 200, 400}, ReqCounter: 5, ErrCounter: 1},
+			100, 250, 400, 200, 400, 111.80, 166.67, 20,
+		},
+		{
+			"no success",
+			&PingStat{ReqCounter: 2, ErrCounter: 2},
+			0, 0, 0, 0, 0, 0, 0, 100,
+		},
+	}
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 0.01
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.stat
+			p.CalStats()
+			if p.MinMs != tt.min || p.AvgMs != tt.avg || p.MaxMs != tt.max {
+				t.Errorf("min/avg/max = %d/%d/%d, want %d/%d/%d", p.MinMs, p.AvgMs, p.MaxMs, tt.min, tt.avg, tt.max)
+			}
+			if p.MedianMs != tt.median || p.P90Ms != tt.p90 {
+				t.Errorf("median/p90 = %d/%d, want %d/%d", p.MedianMs, p.P90Ms, tt.median, tt.p90)
+			}
+			if !near(p.MdevMs, tt.mdev) || !near(p.JitterMs, tt.jitter) {
+				t.Errorf("mdev/jitter = %.2f/%.2f, want %.2f/%.2f", p.MdevMs, p.JitterMs, tt.mdev, tt.jitter)
+			}
+			if !near(p.LossPercent, tt.loss) {
+				t.Errorf("loss = %.2f, want %.2f", p.LossPercent, tt.loss)
+			}
+		})
+	}
+}
+
+func TestOptionsWithDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		want *Options
+	}{
+		{
+			"nil",
+			nil,
+			&Options{Count: 3, Dest: "http://www.google.com/gen_204", Timeout: 10 * time.Second},
+		},
+		{
+			"set",
+			&Options{Count: 1, Dest: "http://example.com/", Timeout: time.Second, Quit: 1, UseMux: true},
+			&Options{Count: 1, Dest: "http://example.com/", Timeout: time.Second, Quit: 1, UseMux: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := cmp.Diff(tt.want, tt.opts.withDefaults()); d != "" {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestRunNilOptions(t *testing.T) {
+	// an invalid link fails before any request, but after options are read
+	if _, err := NewPinger("vmess://invalid", nil).Run(context.Background()); err == nil {
+		t.Error("want error")
+	}
+	results, err := PingMany(context.Background(), []*Node{{Name: "invalid", Vmess: "vmess://invalid"}}, 1, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err == nil {
+		t.Error("want error of node")
+	}
+}
+
+func TestPingManyCanceled(t *testing.T) {
+	link := "vmess://eyJ2IjoiMiIsImFkZCI6IjEyNy4wLjAuMSIsInBvcnQiOiIxIiwiaWQiOiIyN2I4YTYyNS00ZjRiLTQ0MjgtOWYwZi04YTIzMTdkYjdjNzkiLCJhaWQiOiIwIiwibmV0IjoidGNwIiwidHlwZSI6Im5vbmUifQ=="
+	nodes := []*Node{{Name: "a", Vmess: link}, {Name: "b", Vmess: link}, {Name: "invalid", Vmess: "vmess://invalid"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the only worker is held by node a, until node b is given up
+	setup := func(p *Pinger) {
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+	}
+	results, err := PingMany(ctx, nodes, 1, &Options{Count: 1, Timeout: time.Second}, setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(nodes) {
+		t.Fatalf("got %d results, want %d", len(results), len(nodes))
+	}
+	for i, r := range results {
+		if r.Node != nodes[i] {
+			t.Errorf("result %d is of node %s, want %s", i, r.Node.Name, nodes[i].Name)
+		}
+	}
+	if results[0].Stat == nil {
+		t.Errorf("node a: want stat, got error %v", results[0].Err)
+	}
+	if results[1].Stat != nil || results[1].Err == nil {
+		t.Error("node b: want error of not pinged")
+	}
+	if results[2].Err == nil {
+		t.Error("node invalid: want error")
+	}
+}
+
+func TestRunProtocols(t *testing.T) {
+	// the servers are unreachable, but the core should take the outbounds
+	tests := []struct {
+		name string
+		link string
+	}{
+		{"vmess", "vmess://eyJ2IjoiMiIsImFkZCI6IjEyNy4wLjAuMSIsInBvcnQiOiIxIiwiaWQiOiIyN2I4YTYyNS00ZjRiLTQ0MjgtOWYwZi04YTIzMTdkYjdjNzkiLCJhaWQiOiIwIiwibmV0IjoidGNwIiwidHlwZSI6Im5vbmUifQ=="},
+		// fails the validation, but the core takes the scy as "auto"
+		{"vmess unknown scy", "vmess://eyJ2IjoiMiIsImFkZCI6IjEyNy4wLjAuMSIsInBvcnQiOiIxIiwiaWQiOiIyN2I4YTYyNS00ZjRiLTQ0MjgtOWYwZi04YTIzMTdkYjdjNzkiLCJhaWQiOiIwIiwibmV0IjoidGNwIiwidHlwZSI6Im5vbmUiLCJzY3kiOiJhZXMtMTI4LWNmYiJ9"},
+		{"vless", "vless://b831381d-6324-4d53-ad4f-8cda48b30811@127.0.0.1:1?type=ws&security=tls&path=%2Fws"},
+		{"trojan", "trojan://pass@127.0.0.1:1?sni=sni.example.com&type=ws&path=%2Fws"},
+		{"vless grpc", "vless://b831381d-6324-4d53-ad4f-8cda48b30811@127.0.0.1:1?type=grpc&security=tls&serviceName=svc&mode=multi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := NewPinger(tt.link, &Options{Count: 1, Dest: "http://127.0.0.1:1/", Timeout: time.Second}).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.ReqCounter != 1 || stat.ErrCounter != 1 {
+				t.Errorf("got %d requests, %d errors", stat.ReqCounter, stat.ErrCounter)
+			}
+		})
+	}
+}
+
+func TestJSONReporterResult(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r, err := NewReporter(buf, "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &NodeInfo{Name: "a"}
+	// a probe of 0ms is a success, not an empty record
+	r.Result(node, 1, 0, nil)
+	r.Result(node, 2, 0, errors.New("timeout"))
+	want := `{"type":"probe","node":"a","seq":1,"time_ms":0}
+{"type":"probe","node":"a","seq":2,"time_ms":0,"error":"timeout"}
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestPing(t *testing.T) {
+	link := "vmess://eyJ2IjoiMiIsImFkZCI6IjEyNy4wLjAuMSIsInBvcnQiOiIxIiwiaWQiOiIyN2I4YTYyNS00ZjRiLTQ0MjgtOWYwZi04YTIzMTdkYjdjNzkiLCJhaWQiOiIwIiwibmV0IjoidGNwIiwidHlwZSI6Im5vbmUifQ=="
+	stat, err := Ping(link, 1, "http://127.0.0.1:1/", 1, 1, 0, nil, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.ReqCounter != 1 || stat.ErrCounter != 1 {
+		t.Errorf("got %d requests, %d errors", stat.ReqCounter, stat.ErrCounter)
+	}
+}
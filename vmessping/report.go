@@ -0,0 +1,225 @@
+package vmessping
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/qjebbs/v2tool/vmess"
+)
+
+// NodeInfo describes a node being pinged
+type NodeInfo struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol,omitempty"`
+	Net      string `json:"net,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Port     string `json:"port,omitempty"`
+	TLS      string `json:"tls,omitempty"`
+	Location string `json:"location,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	// Detail is the human readable detail of a link node
+	Detail string `json:"-"`
+}
+
+// newNodeInfo creates NodeInfo for vm, which is a share link or a json file.
+// name is used when it's not empty, or falls back to link remarks / file path.
+func newNodeInfo(name, vm string) *NodeInfo {
+	n := &NodeInfo{Name: name}
+	if vmess.IsSupportedLink(vm) {
+		if lk, err := vmess.ParseLink(vm); err == nil {
+			n.Protocol = lk.Protocol()
+			n.Address, n.Port = lk.Server()
+			n.Detail = lk.DetailStr()
+			if n.Name == "" {
+				n.Name = lk.Remarks()
+			}
+			switch l := lk.(type) {
+			case *vmess.Link:
+				n.Net, n.TLS = l.Net, l.TLS
+			case *vmess.VlessLink:
+				n.Net, n.TLS = l.Net, l.TLS
+			case *vmess.TrojanLink:
+				n.Net, n.TLS = l.Net, l.TLS
+			}
+		}
+	}
+	if n.Name == "" {
+		n.Name = vm
+	}
+	return n
+}
+
+// Reporter reports the progress and results of pings.
+// Implementations are safe for concurrent use.
+type Reporter interface {
+	// Node is called when a node is ready to ping
+	Node(node *NodeInfo)
+	// Located is called when the location of a node is resolved
+	Located(node *NodeInfo)
+	// Result is called after each request
+	Result(node *NodeInfo, seq uint, delay int64, err error)
+	// Summary is called when pinging to a node finishes
+	Summary(node *NodeInfo, stat *PingStat)
+}
+
+// Attach sets the hooks of p to send events to rep
+func Attach(p *Pinger, rep Reporter) {
+	p.OnNode = rep.Node
+	p.OnLocated = rep.Located
+	p.OnResult = func(seq uint, delay int64, err error) {
+		rep.Result(p.Node, seq, delay, err)
+	}
+	p.OnFinish = func(stat *PingStat) {
+		rep.Summary(p.Node, stat)
+	}
+}
+
+// NewReporter creates a reporter writes to w in format, which could be "text", "json" or "csv"
+func NewReporter(w io.Writer, format string, dest string) (Reporter, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return &textReporter{w: w, dest: dest}, nil
+	case "json":
+		return &jsonReporter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvReporter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %s", format)
+}
+
+type textReporter struct {
+	sync.Mutex
+	w    io.Writer
+	dest string
+}
+
+func (r *textReporter) Node(node *NodeInfo) {
+	r.Lock()
+	defer r.Unlock()
+	if node.Detail != "" {
+		fmt.Fprintln(r.w, "\n"+node.Detail)
+	}
+}
+
+func (r *textReporter) Located(node *NodeInfo) {
+	r.Lock()
+	defer r.Unlock()
+	fmt.Fprintf(r.w, "Node Outbound: %s/%s\n", node.Location, node.IP)
+}
+
+func (r *textReporter) Result(node *NodeInfo, seq uint, delay int64, err error) {
+	r.Lock()
+	defer r.Unlock()
+	if err != nil {
+		fmt.Fprintf(r.w, "Ping %s: seq=%d err %v\n", r.dest, seq, err)
+		return
+	}
+	fmt.Fprintf(r.w, "Ping %s: seq=%d time=%d ms\n", r.dest, seq, delay)
+}
+
+func (r *textReporter) Summary(node *NodeInfo, stat *PingStat) {
+	r.Lock()
+	defer r.Unlock()
+	stat.writeStats(r.w)
+}
+
+type probeRecord struct {
+	Type   string `json:"type"`
+	Node   string `json:"node"`
+	Seq    uint   `json:"seq"`
+	TimeMs int64  `json:"time_ms"`
+	Error  string `json:"error,omitempty"`
+}
+
+type summaryRecord struct {
+	Type  string    `json:"type"`
+	Node  *NodeInfo `json:"node"`
+	Stats *PingStat `json:"stats"`
+}
+
+type jsonReporter struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *jsonReporter) Node(node *NodeInfo) {}
+
+func (r *jsonReporter) Located(node *NodeInfo) {}
+
+func (r *jsonReporter) Result(node *NodeInfo, seq uint, delay int64, err error) {
+	r.Lock()
+	defer r.Unlock()
+	rec := &probeRecord{Type: "probe", Node: node.Name, Seq: seq}
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.TimeMs = delay
+	}
+	r.enc.Encode(rec)
+}
+
+func (r *jsonReporter) Summary(node *NodeInfo, stat *PingStat) {
+	r.Lock()
+	defer r.Unlock()
+	r.enc.Encode(&summaryRecord{Type: "summary", Node: node, Stats: stat})
+}
+
+var csvHeader = []string{
+	"type", "node", "seq", "time_ms", "error",
+	"address", "port", "location", "ip",
+	"requests", "errors", "loss_percent", "min_ms", "avg_ms", "max_ms",
+	"median_ms", "p90_ms", "p95_ms", "p99_ms", "mdev_ms", "jitter_ms",
+}
+
+type csvReporter struct {
+	sync.Mutex
+	w          *csv.Writer
+	headerDone bool
+}
+
+func (r *csvReporter) write(record []string) {
+	if !r.headerDone {
+		r.w.Write(csvHeader)
+		r.headerDone = true
+	}
+	r.w.Write(record)
+	r.w.Flush()
+}
+
+func (r *csvReporter) Node(node *NodeInfo) {}
+
+func (r *csvReporter) Located(node *NodeInfo) {}
+
+func (r *csvReporter) Result(node *NodeInfo, seq uint, delay int64, err error) {
+	r.Lock()
+	defer r.Unlock()
+	rec := make([]string, len(csvHeader))
+	rec[0], rec[1], rec[2] = "probe", node.Name, strconv.FormatUint(uint64(seq), 10)
+	if err != nil {
+		rec[4] = err.Error()
+	} else {
+		rec[3] = strconv.FormatInt(delay, 10)
+	}
+	r.write(rec)
+}
+
+func (r *csvReporter) Summary(node *NodeInfo, stat *PingStat) {
+	r.Lock()
+	defer r.Unlock()
+	u := func(v uint) string { return strconv.FormatUint(uint64(v), 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	rec := []string{
+		"summary", node.Name, "", "", "",
+		node.Address, node.Port, node.Location, node.IP,
+		u(stat.ReqCounter), u(stat.ErrCounter), f(stat.LossPercent),
+		u(stat.MinMs), u(stat.AvgMs), u(stat.MaxMs),
+		u(stat.MedianMs), u(stat.P90Ms), u(stat.P95Ms), u(stat.P99Ms),
+		f(stat.MdevMs), f(stat.JitterMs),
+	}
+	r.write(rec)
+}